@@ -0,0 +1,133 @@
+package dockerManager
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ContextHash hashes the Dockerfile in buildContextPath together with every file it copies into the image. Files of
+// the context which are not copied, like the trainings data or trained models, do not change the hash.
+func ContextHash(buildContextPath string) (string, error) {
+	dockerfile, err := os.ReadFile(filepath.Join(buildContextPath, "Dockerfile"))
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	hash.Write(dockerfile)
+
+	sources, err := copiedSources(string(dockerfile))
+	if err != nil {
+		return "", err
+	}
+
+	var files []string
+	for _, source := range sources {
+		if strings.Contains(source, "://") {
+			// remote sources of ADD can not be hashed, the url has to change for a rebuild
+			fmt.Fprintf(hash, "url %s\n", source)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(buildContextPath, source))
+		if err != nil {
+			return "", err
+		}
+		if len(matches) == 0 {
+			return "", fmt.Errorf("copied source %s does not exist in %s", source, buildContextPath)
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() {
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	sort.Strings(files)
+	for _, file := range files {
+		relative, err := filepath.Rel(buildContextPath, file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "file %s\n", filepath.ToSlash(relative))
+		if err := hashFile(hash, file); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copiedSources returns the sources of all COPY and ADD instructions, except the ones copying from another stage.
+func copiedSources(dockerfile string) ([]string, error) {
+	var sources []string
+	scanner := bufio.NewScanner(strings.NewReader(joinContinuedLines(dockerfile)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		instruction := strings.ToUpper(fields[0])
+		if instruction != "COPY" && instruction != "ADD" {
+			continue
+		}
+
+		arguments := fields[1:]
+		fromStage := false
+		for len(arguments) > 0 && strings.HasPrefix(arguments[0], "--") {
+			if strings.HasPrefix(arguments[0], "--from=") {
+				fromStage = true
+			}
+			arguments = arguments[1:]
+		}
+		if fromStage {
+			continue
+		}
+
+		rest := strings.Join(arguments, " ")
+		if strings.HasPrefix(rest, "[") {
+			var jsonArguments []string
+			if err := json.Unmarshal([]byte(rest), &jsonArguments); err != nil {
+				return nil, fmt.Errorf("invalid %s instruction: %w", instruction, err)
+			}
+			arguments = jsonArguments
+		}
+
+		// the last argument is the destination inside the image
+		if len(arguments) > 1 {
+			sources = append(sources, arguments[:len(arguments)-1]...)
+		}
+	}
+	return sources, scanner.Err()
+}
+
+func joinContinuedLines(dockerfile string) string {
+	return strings.NewReplacer("\\\r\n", " ", "\\\n", " ").Replace(dockerfile)
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,110 @@
+package dockerManager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCopiedSources(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       []string
+		wantErr    bool
+	}{
+		{name: "copy", dockerfile: "FROM python\nCOPY app.py /app/\n", want: []string{"app.py"}},
+		{name: "several sources", dockerfile: "COPY a.py b.py /app/\nADD c.tar /app/\n", want: []string{"a.py", "b.py", "c.tar"}},
+		{name: "lower case", dockerfile: "copy app.py /app/\n", want: []string{"app.py"}},
+		{name: "flags", dockerfile: "COPY --chown=app:app app.py /app/\n", want: []string{"app.py"}},
+		{name: "other stage", dockerfile: "COPY --from=build /out/app /app\nCOPY app.py /app/\n", want: []string{"app.py"}},
+		{name: "json form", dockerfile: `COPY ["my app.py", "/app/"]` + "\n", want: []string{"my app.py"}},
+		{name: "continued line", dockerfile: "COPY a.py \\\n  b.py /app/\n", want: []string{"a.py", "b.py"}},
+		{name: "remote source", dockerfile: "ADD https://example.com/model.bin /app/\n", want: []string{"https://example.com/model.bin"}},
+		{name: "nothing copied", dockerfile: "FROM python\nRUN pip install spacy\n"},
+		{name: "invalid json", dockerfile: `COPY ["app.py", "/app/"` + "\n", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := copiedSources(test.dockerfile)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("copiedSources() error = %v, want error %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("copiedSources() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// writeContext writes the files of a build context into a new temporary folder.
+func writeContext(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestContextHash(t *testing.T) {
+	base := map[string]string{
+		"Dockerfile":         "FROM python\nCOPY app.py /app/\nCOPY lib /app/lib\n",
+		"app.py":             "print('hello')",
+		"lib/util.py":        "x = 1",
+		"data/training.json": "[]",
+	}
+
+	tests := []struct {
+		name string
+		// change is applied to a copy of base, an empty content removes the file
+		change      map[string]string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{name: "unchanged", change: map[string]string{}},
+		{name: "file which is not copied", change: map[string]string{"data/training.json": `[{"text": "a"}]`}},
+		{name: "copied file", change: map[string]string{"app.py": "print('bye')"}, wantChanged: true},
+		{name: "file in copied folder", change: map[string]string{"lib/util.py": "x = 2"}, wantChanged: true},
+		{name: "new file in copied folder", change: map[string]string{"lib/more.py": "y = 1"}, wantChanged: true},
+		{name: "dockerfile", change: map[string]string{"Dockerfile": "FROM python:3.9\nCOPY app.py /app/\nCOPY lib /app/lib\n"}, wantChanged: true},
+		{name: "missing source", change: map[string]string{"app.py": ""}, wantErr: true},
+	}
+
+	want, err := ContextHash(writeContext(t, base))
+	if err != nil {
+		t.Fatalf("ContextHash() error = %v", err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := make(map[string]string)
+			for name, content := range base {
+				files[name] = content
+			}
+			for name, content := range test.change {
+				if content == "" {
+					delete(files, name)
+				} else {
+					files[name] = content
+				}
+			}
+
+			got, err := ContextHash(writeContext(t, files))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ContextHash() error = %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && (got != want) != test.wantChanged {
+				t.Errorf("ContextHash() changed = %v, want %v", got != want, test.wantChanged)
+			}
+		})
+	}
+}
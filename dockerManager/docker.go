@@ -1,35 +1,139 @@
 package dockerManager
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/docker/distribution/context"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// States of a tracked container, see ContainerInformation.State and helper.ContainerRegistry for the transitions.
+const (
+	StateBuilding  = "building"
+	StateStarting  = "starting"
+	StateReady     = "ready"
+	StateUnhealthy = "unhealthy"
+	StateExited    = "exited"
+	StateStopping  = "stopping"
+	StateStopped   = "stopped"
+	StateFailed    = "failed"
+)
+
 type ContainerInformation struct {
 	Port    string
 	ModelId string
 	Version string
 	Ip      string
+	// Address is the host:port of the model server, see ContainerStatus.Address.
+	Address string
+	State   string
+	// LastRequest is the time the last request was proxied to the container, or the start time if there was none.
+	LastRequest time.Time
+	// InFlight counts the requests currently proxied to the container.
+	InFlight int
+	// Restarts counts how often the container was restarted after it crashed.
+	Restarts int
 }
 
-// Build takes a buildContextPath which is the path where the Dockerfile lies. The tags are for the name, version, etc.
-func Build(buildContextPath string, tags []string) error {
+// stopGracePeriod is how long a container gets to exit after SIGTERM before docker kills it.
+const stopGracePeriod = 10 * time.Second
+
+// DockerTimeouts limit how long a call to the docker daemon may take. Following logs and events is not limited.
+type DockerTimeouts struct {
+	Build time.Duration
+	// Start covers creating and starting a container, and restarting it.
+	Start time.Duration
+	// Stop has to be longer than the stopGracePeriod.
+	Stop time.Duration
+	// Remove covers removing containers and images.
+	Remove time.Duration
+	// Inspect covers inspecting and listing containers and images.
+	Inspect time.Duration
+}
+
+// DefaultDockerTimeouts are overridden by COMPANION_DOCKER_TIMEOUTS, e.g. build=1h,stop=1m. The keys are the fields of
+// DockerTimeouts in lower case.
+func DefaultDockerTimeouts() (DockerTimeouts, error) {
+	timeouts := DockerTimeouts{
+		Build:   30 * time.Minute,
+		Start:   time.Minute,
+		Stop:    30 * time.Second,
+		Remove:  time.Minute,
+		Inspect: 10 * time.Second,
+	}
 
-	ctx := context.Background()
+	value := os.Getenv("COMPANION_DOCKER_TIMEOUTS")
+	if value == "" {
+		return timeouts, nil
+	}
+	fields := map[string]*time.Duration{
+		"build":   &timeouts.Build,
+		"start":   &timeouts.Start,
+		"stop":    &timeouts.Stop,
+		"remove":  &timeouts.Remove,
+		"inspect": &timeouts.Inspect,
+	}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		field, ok := fields[parts[0]]
+		if len(parts) != 2 || !ok {
+			return timeouts, fmt.Errorf("invalid docker timeout %q", entry)
+		}
+		timeout, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return timeouts, fmt.Errorf("invalid docker timeout %q: %w", entry, err)
+		}
+		*field = timeout
+	}
+	return timeouts, nil
+}
+
+// DockerRuntime runs the model containers on the local docker daemon, attached to a managed network. It keeps one
+// client for all calls, the client is safe for concurrent use.
+type DockerRuntime struct {
+	Network  *DockerNetwork
+	Timeouts DockerTimeouts
+
+	cli *client.Client
+}
+
+func NewDockerRuntime() (*DockerRuntime, error) {
+	timeouts, err := DefaultDockerTimeouts()
+	if err != nil {
+		return nil, err
+	}
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	return &DockerRuntime{Network: DefaultDockerNetwork(), Timeouts: timeouts, cli: cli}, nil
+}
+
+// Build takes a buildContextPath which is the path where the Dockerfile lies. The tags are for the name, version, etc.
+func (d *DockerRuntime) Build(ctx context.Context, buildContextPath string, tags []string, labels map[string]string, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Build)
+	defer cancel()
 
 	buildOpts := types.ImageBuildOptions{
 		Dockerfile: "Dockerfile",
 		Tags:       tags,
+		Labels:     labels,
 	}
 
 	buildCtx, err := archive.TarWithOptions(buildContextPath, &archive.TarOptions{})
@@ -37,114 +141,307 @@ func Build(buildContextPath string, tags []string) error {
 		return err
 	}
 
-	resp, err := cli.ImageBuild(ctx, buildCtx, buildOpts)
+	resp, err := d.cli.ImageBuild(ctx, buildCtx, buildOpts)
 	if err != nil {
-		return err
+		return dockerError("build", err)
 	}
-
 	defer resp.Body.Close()
-	_, err = io.Copy(os.Stdout, resp.Body)
+
+	// the daemon answers with a stream of json messages, a failing step is reported inside the stream and not by the
+	// status code of the response
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message jsonmessage.JSONMessage
+		err := decoder.Decode(&message)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return dockerError("build", err)
+		}
+
+		if message.Error != nil {
+			return message.Error
+		}
+		if message.ErrorMessage != "" {
+			return errors.New(message.ErrorMessage)
+		}
+
+		if message.Stream != "" {
+			_, err = io.WriteString(out, message.Stream)
+		} else if message.Status != "" {
+			_, err = fmt.Fprintln(out, message.Status, message.ProgressMessage)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *DockerRuntime) ImageExists(ctx context.Context, tag string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Inspect)
+	defer cancel()
+
+	_, _, err := d.cli.ImageInspectWithRaw(ctx, tag)
+	if client.IsErrNotFound(err) {
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, dockerError("inspect image", err)
 	}
-	return nil
+	return true, nil
 }
 
-func Start(imageName string, sourceMountPath string, targetMountPath string, containerPort string) (string, error) {
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+func (d *DockerRuntime) Images(ctx context.Context) ([]ImageStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Inspect)
+	defer cancel()
+
+	images, err := d.cli.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelModelId)),
+	})
 	if err != nil {
-		return "", err
+		return nil, dockerError("list images", err)
+	}
+
+	statuses := make([]ImageStatus, 0, len(images))
+	for _, image := range images {
+		statuses = append(statuses, ImageStatus{
+			Id:      image.ID,
+			Tags:    image.RepoTags,
+			Labels:  image.Labels,
+			Created: time.Unix(image.Created, 0),
+			Size:    image.Size,
+		})
+	}
+	return statuses, nil
+}
+
+func (d *DockerRuntime) RemoveImage(ctx context.Context, imageId string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Remove)
+	defer cancel()
+
+	// without force docker refuses to remove images which are used by a container
+	_, err := d.cli.ImageRemove(ctx, imageId, types.ImageRemoveOptions{PruneChildren: true})
+	return dockerError("remove image", err)
+}
+
+func (d *DockerRuntime) Start(ctx context.Context, options StartOptions) (string, error) {
+	if options.SourceMountPath == "" {
+		return "", errors.New("docker containers need the host path of the model folder, start the server with the host path of mnt")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Start)
+	defer cancel()
+
+	if err := d.Network.ensure(ctx, d.cli); err != nil {
+		return "", dockerError("start", fmt.Errorf("could not set up network %s: %w", d.Network.Name, err))
 	}
 
 	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode(d.Network.Name),
 		PortBindings: nat.PortMap{
-			"5000/tcp": []nat.PortBinding{
+			modelServerPort: []nat.PortBinding{
 				{
 					HostIP:   "0.0.0.0",
-					HostPort: containerPort,
+					HostPort: options.Port,
 				},
 			},
 		},
 		Mounts: []mount.Mount{
 			{
 				Type:   mount.TypeBind,
-				Source: sourceMountPath,
-				Target: targetMountPath,
+				Source: options.SourceMountPath,
+				Target: options.TargetMountPath,
 			},
 		},
+		Resources: container.Resources{
+			NanoCPUs: options.Resources.NanoCpus,
+			Memory:   options.Resources.Memory,
+		},
+	}
+	if options.Resources.PidsLimit > 0 {
+		hostConfig.Resources.PidsLimit = &options.Resources.PidsLimit
 	}
 
-	resp, err := cli.ContainerCreate(ctx, &container.Config{
-		Image: imageName,
+	resp, err := d.cli.ContainerCreate(ctx, &container.Config{
+		Image:  options.Image,
+		Labels: options.Labels,
 		ExposedPorts: nat.PortSet{
-			"5000/tcp": struct{}{},
+			modelServerPort: struct{}{},
 		},
-	}, hostConfig, nil, nil, "")
+	}, hostConfig, &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{d.Network.Name: {}},
+	}, nil, containerName(options.Labels))
 	if err != nil {
-		return "", err
+		return "", dockerError("start", err)
 	}
 
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		return "", err
+	if err := d.cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return "", dockerError("start", err)
 	}
 
 	fmt.Println(resp.ID)
 	return resp.ID, nil
 }
 
-func StopAll(containerTracker map[string]ContainerInformation) error {
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		return err
-	}
+func (d *DockerRuntime) Stop(ctx context.Context, containerId string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Stop)
+	defer cancel()
 
-	for id := range containerTracker {
-		fmt.Print("Stopping container ", id, "... ")
-		var d time.Duration = -1
-		err = cli.ContainerStop(ctx, id, &d)
-		if err != nil {
-			return err
-		}
-		fmt.Println("Success")
+	fmt.Print("Stopping container ", containerId, "... ")
+	gracePeriod := stopGracePeriod
+	err := d.cli.ContainerStop(ctx, containerId, &gracePeriod)
+	if err != nil {
+		return dockerError("stop", err)
 	}
+	fmt.Println("Success")
 
-	//TODO remove container id from global list
 	return nil
 }
 
-func Stop(containerId string) error {
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+func (d *DockerRuntime) Remove(ctx context.Context, containerId string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Remove)
+	defer cancel()
+
+	return dockerError("remove", d.cli.ContainerRemove(ctx, containerId, types.ContainerRemoveOptions{}))
+}
+
+func (d *DockerRuntime) Restart(ctx context.Context, containerId string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Start)
+	defer cancel()
+
+	gracePeriod := stopGracePeriod
+	return dockerError("restart", d.cli.ContainerRestart(ctx, containerId, &gracePeriod))
+}
+
+func (d *DockerRuntime) Inspect(ctx context.Context, containerId string) (ContainerStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Inspect)
+	defer cancel()
+
+	containerInformation, err := d.cli.ContainerInspect(ctx, containerId)
 	if err != nil {
-		return err
+		return ContainerStatus{}, dockerError("inspect", err)
 	}
 
-	fmt.Print("Stopping container ", containerId, "... ")
-	var d time.Duration = -1
-	err = cli.ContainerStop(ctx, containerId, &d)
-	if err != nil {
-		return err
+	status := ContainerStatus{
+		Id:      containerInformation.ID,
+		Ip:      containerInformation.NetworkSettings.IPAddress,
+		Running: containerInformation.State != nil && containerInformation.State.Running,
+		Image:   containerInformation.Config.Image,
+		Labels:  containerInformation.Config.Labels,
 	}
-	fmt.Println("Success")
+	// the default ip address is empty for containers on user-defined networks
+	if endpoint, ok := containerInformation.NetworkSettings.Networks[d.Network.Name]; ok {
+		status.Ip = endpoint.IPAddress
+	}
+	hostPort := ""
+	if bindings := containerInformation.NetworkSettings.Ports[modelServerPort]; len(bindings) > 0 {
+		hostPort = bindings[0].HostPort
+	}
+	status.Address = d.Network.address(containerInformation.Name, hostPort)
 
-	//TODO remove container id from global list
-	return nil
+	return status, nil
 }
 
-func GetContainerIp(containerId string) (string, error) {
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+func (d *DockerRuntime) List(ctx context.Context) ([]ContainerStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeouts.Inspect)
+	defer cancel()
+
+	containers, err := d.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelModelId)),
+	})
 	if err != nil {
-		return "", err
+		return nil, dockerError("list", err)
+	}
+
+	statuses := make([]ContainerStatus, 0, len(containers))
+	for _, c := range containers {
+		status := ContainerStatus{Id: c.ID, Running: c.State == "running", Image: c.Image, Labels: c.Labels}
+		if c.NetworkSettings != nil {
+			if endpoint, ok := c.NetworkSettings.Networks[d.Network.Name]; ok {
+				status.Ip = endpoint.IPAddress
+			}
+		}
+		hostPort := ""
+		for _, port := range c.Ports {
+			if port.PrivatePort == uint16(modelServerPort.Int()) && port.PublicPort != 0 {
+				hostPort = strconv.Itoa(int(port.PublicPort))
+			}
+		}
+		name := ""
+		if len(c.Names) > 0 {
+			name = c.Names[0]
+		}
+		status.Address = d.Network.address(name, hostPort)
+		statuses = append(statuses, status)
 	}
+	return statuses, nil
+}
 
-	containerInformation, err := cli.ContainerInspect(ctx, containerId)
+// Logs demultiplexes the log stream of the container, docker sends stdout and stderr combined over one connection.
+func (d *DockerRuntime) Logs(ctx context.Context, containerId string, options LogOptions, stdout io.Writer, stderr io.Writer) error {
+	if !options.Follow {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeouts.Inspect)
+		defer cancel()
+	}
+
+	logOptions := types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     options.Follow,
+		Tail:       options.Tail,
+	}
+	if tail, err := strconv.Atoi(options.Tail); err == nil && tail < 0 {
+		logOptions.Tail = "0"
+	}
+	if !options.Since.IsZero() {
+		logOptions.Since = strconv.FormatInt(options.Since.Unix(), 10)
+	}
+
+	logs, err := d.cli.ContainerLogs(ctx, containerId, logOptions)
 	if err != nil {
-		return "", err
+		return dockerError("logs", err)
 	}
+	defer logs.Close()
 
-	return containerInformation.NetworkSettings.IPAddress, nil
+	_, err = stdcopy.StdCopy(stdout, stderr, logs)
+	if options.Follow && ctx.Err() != nil {
+		// a follow stopped by the caller is no error
+		return nil
+	}
+	return dockerError("logs", err)
+}
 
+func (d *DockerRuntime) Events(ctx context.Context, handle func(event ContainerEvent)) error {
+	messages, errs := d.cli.Events(ctx, types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", events.ContainerEventType),
+			filters.Arg("label", LabelModelId),
+			filters.Arg("event", EventDie),
+			filters.Arg("event", EventOom),
+			filters.Arg("event", EventStop),
+		),
+	})
+	for {
+		select {
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return dockerError("events", err)
+		case message := <-messages:
+			event := ContainerEvent{
+				ContainerId: message.Actor.ID,
+				Action:      message.Action,
+				Labels:      message.Actor.Attributes,
+				Time:        time.Unix(0, message.TimeNano),
+			}
+			if exitCode, err := strconv.Atoi(message.Actor.Attributes["exitCode"]); err == nil {
+				event.ExitCode = exitCode
+			}
+			handle(event)
+		}
+	}
 }
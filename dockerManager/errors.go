@@ -0,0 +1,58 @@
+package dockerManager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/client"
+)
+
+// Kinds of a RuntimeError, match them with errors.Is.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrDaemonUnavailable = errors.New("docker daemon is unavailable")
+	ErrTimeout           = errors.New("timed out")
+)
+
+// RuntimeError is returned by the runtimes when an operation fails. errors.Is matches it against its Kind as well as
+// the wrapped error.
+type RuntimeError struct {
+	Op string
+	// Kind is one of ErrNotFound, ErrDaemonUnavailable or ErrTimeout, nil for all other failures.
+	Kind error
+	Err  error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RuntimeError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// dockerError classifies an error of the docker client, nil stays nil.
+func dockerError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var kind error
+	switch {
+	case client.IsErrNotFound(err):
+		kind = ErrNotFound
+	case client.IsErrConnectionFailed(err):
+		kind = ErrDaemonUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		kind = ErrTimeout
+	}
+	return &RuntimeError{Op: op, Kind: kind, Err: err}
+}
+
+func notFound(op string, format string, args ...interface{}) error {
+	return &RuntimeError{Op: op, Kind: ErrNotFound, Err: fmt.Errorf(format, args...)}
+}
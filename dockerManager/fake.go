@@ -0,0 +1,314 @@
+package dockerManager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// FakeRuntime is an in-memory Runtime which does not need a docker daemon. Builds only remember the tags and started
+// containers report Ip as their address, so a locally running model server can stand in for the container.
+type FakeRuntime struct {
+	Ip string
+
+	mu          sync.Mutex
+	nextId      int
+	images      map[string]fakeImage
+	containers  map[string]*fakeContainer
+	subscribers map[chan ContainerEvent]struct{}
+	// subscribed is closed once the first caller of Events receives the events.
+	subscribed     chan struct{}
+	subscribedOnce sync.Once
+}
+
+type fakeImage struct {
+	id      string
+	labels  map[string]string
+	created time.Time
+}
+
+type fakeContainer struct {
+	image   string
+	port    string
+	running bool
+	labels  map[string]string
+	logs    []fakeLogLine
+}
+
+type fakeLogLine struct {
+	time time.Time
+	line string
+}
+
+func newFakeLogLine(line string) fakeLogLine {
+	return fakeLogLine{time: time.Now(), line: line}
+}
+
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		Ip:          "127.0.0.1",
+		images:      make(map[string]fakeImage),
+		containers:  make(map[string]*fakeContainer),
+		subscribers: make(map[chan ContainerEvent]struct{}),
+		subscribed:  make(chan struct{}),
+	}
+}
+
+func (f *FakeRuntime) Build(ctx context.Context, buildContextPath string, tags []string, labels map[string]string, out io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextId++
+	image := fakeImage{id: fmt.Sprintf("sha256:fake-%d", f.nextId), labels: labels, created: time.Now()}
+	for _, tag := range tags {
+		f.images[tag] = image
+		if _, err := fmt.Fprintf(out, "Successfully tagged %s\n", tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FakeRuntime) ImageExists(ctx context.Context, tag string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.images[tag]
+	return ok, nil
+}
+
+func (f *FakeRuntime) Images(ctx context.Context) ([]ImageStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	byId := make(map[string]*ImageStatus)
+	var ids []string
+	for tag, image := range f.images {
+		if _, ok := image.labels[LabelModelId]; !ok {
+			continue
+		}
+		status, ok := byId[image.id]
+		if !ok {
+			status = &ImageStatus{Id: image.id, Labels: image.labels, Created: image.created}
+			byId[image.id] = status
+			ids = append(ids, image.id)
+		}
+		status.Tags = append(status.Tags, tag)
+	}
+
+	statuses := make([]ImageStatus, 0, len(ids))
+	for _, id := range ids {
+		statuses = append(statuses, *byId[id])
+	}
+	return statuses, nil
+}
+
+func (f *FakeRuntime) RemoveImage(ctx context.Context, imageId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var tags []string
+	for tag, image := range f.images {
+		if image.id == imageId {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return notFound("remove image", "no such image: %s", imageId)
+	}
+	for id, fakeContainer := range f.containers {
+		for _, tag := range tags {
+			if fakeContainer.image == tag {
+				return fmt.Errorf("image %s is being used by container %s", imageId, id)
+			}
+		}
+	}
+	for _, tag := range tags {
+		delete(f.images, tag)
+	}
+	return nil
+}
+
+func (f *FakeRuntime) Start(ctx context.Context, options StartOptions) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.images[options.Image]; !ok {
+		return "", fmt.Errorf("image %s was not built", options.Image)
+	}
+
+	f.nextId++
+	id := fmt.Sprintf("fake-%d", f.nextId)
+	f.containers[id] = &fakeContainer{
+		image:   options.Image,
+		port:    options.Port,
+		running: true,
+		labels:  options.Labels,
+		logs:    []fakeLogLine{newFakeLogLine(fmt.Sprintf("started %s with %s mounted to %s", options.Image, options.SourceMountPath, options.TargetMountPath))},
+	}
+	return id, nil
+}
+
+func (f *FakeRuntime) Stop(ctx context.Context, containerId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fakeContainer, ok := f.containers[containerId]
+	if !ok {
+		return notFound("stop", "no such container: %s", containerId)
+	}
+	fakeContainer.running = false
+	fakeContainer.logs = append(fakeContainer.logs, newFakeLogLine("stopped"))
+	f.emit(containerId, EventDie, 0)
+	f.emit(containerId, EventStop, 0)
+	return nil
+}
+
+func (f *FakeRuntime) Remove(ctx context.Context, containerId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fakeContainer, ok := f.containers[containerId]
+	if !ok {
+		return notFound("remove", "no such container: %s", containerId)
+	}
+	if fakeContainer.running {
+		return fmt.Errorf("container %s is running", containerId)
+	}
+	delete(f.containers, containerId)
+	return nil
+}
+
+func (f *FakeRuntime) Restart(ctx context.Context, containerId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fakeContainer, ok := f.containers[containerId]
+	if !ok {
+		return notFound("restart", "no such container: %s", containerId)
+	}
+	fakeContainer.running = true
+	fakeContainer.logs = append(fakeContainer.logs, newFakeLogLine("restarted"))
+	return nil
+}
+
+// Crash simulates a container which exits on its own, with oom the kernel killed it for using too much memory.
+func (f *FakeRuntime) Crash(containerId string, oom bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fakeContainer, ok := f.containers[containerId]
+	if !ok {
+		return notFound("crash", "no such container: %s", containerId)
+	}
+	fakeContainer.running = false
+	fakeContainer.logs = append(fakeContainer.logs, newFakeLogLine("crashed"))
+	exitCode := 1
+	if oom {
+		exitCode = 137
+		f.emit(containerId, EventOom, 0)
+	}
+	f.emit(containerId, EventDie, exitCode)
+	return nil
+}
+
+func (f *FakeRuntime) Events(ctx context.Context, handle func(event ContainerEvent)) error {
+	events := make(chan ContainerEvent, 16)
+	f.mu.Lock()
+	f.subscribers[events] = struct{}{}
+	f.mu.Unlock()
+	f.subscribedOnce.Do(func() { close(f.subscribed) })
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.subscribers, events)
+		f.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			handle(event)
+		}
+	}
+}
+
+// Subscribed is closed once Events was called, the events emitted afterwards reach the caller.
+func (f *FakeRuntime) Subscribed() <-chan struct{} {
+	return f.subscribed
+}
+
+// emit has to be called with the lock held.
+func (f *FakeRuntime) emit(containerId string, action string, exitCode int) {
+	event := ContainerEvent{
+		ContainerId: containerId,
+		Action:      action,
+		ExitCode:    exitCode,
+		Labels:      f.containers[containerId].labels,
+		Time:        time.Now(),
+	}
+	for subscriber := range f.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (f *FakeRuntime) Inspect(ctx context.Context, containerId string) (ContainerStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fakeContainer, ok := f.containers[containerId]
+	if !ok {
+		return ContainerStatus{}, notFound("inspect", "no such container: %s", containerId)
+	}
+	return ContainerStatus{Id: containerId, Ip: f.Ip, Address: f.Ip + ":5000", Running: fakeContainer.running, Image: fakeContainer.image, Labels: fakeContainer.labels}, nil
+}
+
+func (f *FakeRuntime) List(ctx context.Context) ([]ContainerStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var statuses []ContainerStatus
+	for id, fakeContainer := range f.containers {
+		if _, ok := fakeContainer.labels[LabelModelId]; !ok {
+			continue
+		}
+		statuses = append(statuses, ContainerStatus{Id: id, Ip: f.Ip, Address: f.Ip + ":5000", Running: fakeContainer.running, Image: fakeContainer.image, Labels: fakeContainer.labels})
+	}
+	return statuses, nil
+}
+
+func (f *FakeRuntime) Logs(ctx context.Context, containerId string, options LogOptions, stdout io.Writer, stderr io.Writer) error {
+	f.mu.Lock()
+	fakeContainer, ok := f.containers[containerId]
+	var logs []fakeLogLine
+	if ok {
+		for _, line := range fakeContainer.logs {
+			if !line.time.Before(options.Since) {
+				logs = append(logs, line)
+			}
+		}
+	}
+	f.mu.Unlock()
+
+	if !ok {
+		return notFound("logs", "no such container: %s", containerId)
+	}
+
+	logs = logs[options.tailStart(len(logs)):]
+	for _, line := range logs {
+		if _, err := io.WriteString(stdout, line.line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	if options.Follow {
+		<-ctx.Done()
+	}
+	return nil
+}
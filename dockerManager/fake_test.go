@@ -0,0 +1,91 @@
+package dockerManager
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeBuild, fakeStart and fakeLogs call the runtime like the handlers do.
+func fakeBuild(runtime *FakeRuntime, tag string) error {
+	return runtime.Build(context.Background(), ".", []string{tag}, nil, io.Discard)
+}
+
+func fakeStart(runtime *FakeRuntime, image string) (string, error) {
+	return runtime.Start(context.Background(), StartOptions{Image: image, SourceMountPath: "/host/m1", TargetMountPath: "/app", Port: "5000"})
+}
+
+func fakeLogs(runtime *FakeRuntime, containerId string) (string, error) {
+	var out bytes.Buffer
+	err := runtime.Logs(context.Background(), containerId, LogOptions{}, &out, io.Discard)
+	return out.String(), err
+}
+
+func TestFakeRuntime(t *testing.T) {
+	tests := []struct {
+		name string
+		// image is started after m1:v1 was built
+		image        string
+		stop         bool
+		wantStartErr bool
+		wantRunning  bool
+		wantLastLog  string
+	}{
+		{name: "started", image: "m1:v1", wantRunning: true, wantLastLog: "started m1:v1 with /host/m1 mounted to /app"},
+		{name: "stopped", image: "m1:v1", stop: true, wantLastLog: "stopped"},
+		{name: "image not built", image: "m1:v2", wantStartErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runtime := NewFakeRuntime()
+			if err := fakeBuild(runtime, "m1:v1"); err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			id, err := fakeStart(runtime, test.image)
+			if (err != nil) != test.wantStartErr {
+				t.Fatalf("Start() error = %v, want error %v", err, test.wantStartErr)
+			}
+			if test.wantStartErr {
+				return
+			}
+			if test.stop {
+				if err := runtime.Stop(context.Background(), id); err != nil {
+					t.Fatalf("Stop() error = %v", err)
+				}
+			}
+
+			status, err := runtime.Inspect(context.Background(), id)
+			if err != nil {
+				t.Fatalf("Inspect() error = %v", err)
+			}
+			if status.Id != id || status.Running != test.wantRunning {
+				t.Errorf("Inspect() = %+v, want container %s running %v", status, id, test.wantRunning)
+			}
+
+			logs, err := fakeLogs(runtime, id)
+			if err != nil {
+				t.Fatalf("Logs() error = %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(logs), "\n")
+			if got := lines[len(lines)-1]; got != test.wantLastLog {
+				t.Errorf("last log line = %q, want %q", got, test.wantLastLog)
+			}
+		})
+	}
+}
+
+func TestFakeRuntimeUnknownContainer(t *testing.T) {
+	runtime := NewFakeRuntime()
+	if err := runtime.Stop(context.Background(), "fake-1"); err == nil {
+		t.Error("Stop() of an unknown container succeeded")
+	}
+	if _, err := runtime.Inspect(context.Background(), "fake-1"); err == nil {
+		t.Error("Inspect() of an unknown container succeeded")
+	}
+	if _, err := fakeLogs(runtime, "fake-1"); err == nil {
+		t.Error("Logs() of an unknown container succeeded")
+	}
+}
@@ -0,0 +1,112 @@
+package dockerManager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// modelServerPort is the port the model server listens on inside every container.
+const modelServerPort nat.Port = "5000/tcp"
+
+var invalidNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// Addressing modes for reaching the model containers.
+const (
+	// AddressingDns reaches containers by their name through the managed network. The server has to run in a
+	// container itself, which gets attached to the managed network.
+	AddressingDns = "dns"
+	// AddressingHost reaches containers through their port binding on the host, for servers running outside docker.
+	AddressingHost = "host"
+)
+
+// DockerNetwork configures the network the model containers are attached to.
+type DockerNetwork struct {
+	Name       string
+	Addressing string
+
+	mu    sync.Mutex
+	ready bool
+}
+
+// DefaultDockerNetwork uses COMPANION_NETWORK as network name and picks the addressing by checking whether the server
+// itself runs inside a container. COMPANION_ADDRESSING overrides the detection.
+func DefaultDockerNetwork() *DockerNetwork {
+	name := os.Getenv("COMPANION_NETWORK")
+	if name == "" {
+		name = "companionai"
+	}
+
+	addressing := os.Getenv("COMPANION_ADDRESSING")
+	if addressing != AddressingDns && addressing != AddressingHost {
+		addressing = AddressingHost
+		if _, err := os.Stat("/.dockerenv"); err == nil {
+			addressing = AddressingDns
+		}
+	}
+
+	return &DockerNetwork{Name: name, Addressing: addressing}
+}
+
+// ensure creates the managed network if it is missing and attaches the server container to it when containers are
+// addressed by name. Once it succeeded, later calls return immediately.
+func (n *DockerNetwork) ensure(ctx context.Context, cli *client.Client) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ready {
+		return nil
+	}
+
+	_, err := cli.NetworkInspect(ctx, n.Name, types.NetworkInspectOptions{})
+	if client.IsErrNotFound(err) {
+		_, err = cli.NetworkCreate(ctx, n.Name, types.NetworkCreate{CheckDuplicate: true, Driver: "bridge"})
+	}
+	if err != nil {
+		return err
+	}
+
+	if n.Addressing == AddressingDns {
+		// docker uses the short container id as hostname
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		err = cli.NetworkConnect(ctx, n.Name, hostname, nil)
+		if err != nil && !strings.Contains(err.Error(), "already exists") {
+			return err
+		}
+	}
+
+	n.ready = true
+	return nil
+}
+
+// containerName builds a readable and unique name for a container of the model version, the name is also the
+// hostname of the container inside the managed network.
+func containerName(labels map[string]string) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	name := "companionai"
+	for _, part := range []string{labels[LabelModelId], labels[LabelVersion]} {
+		if part != "" {
+			name += "-" + invalidNameCharacters.ReplaceAllString(part, "-")
+		}
+	}
+	return name + "-" + hex.EncodeToString(suffix)
+}
+
+// address returns how the model server of a container is reached, either by its name or by its host port.
+func (n *DockerNetwork) address(containerName string, hostPort string) string {
+	if n.Addressing == AddressingDns {
+		return strings.TrimPrefix(containerName, "/") + ":" + modelServerPort.Port()
+	}
+	return "127.0.0.1:" + hostPort
+}
@@ -0,0 +1,420 @@
+package dockerManager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxProcessLogLines is the number of output lines kept per process.
+const maxProcessLogLines = 1000
+
+// processStopTimeout is how long a process gets to exit after SIGTERM before it is killed.
+const processStopTimeout = 10 * time.Second
+
+// ProcessRuntime runs the model server of a template as a child process instead of a container. Building only
+// remembers the model folder, which becomes the working directory of the process and is passed to the model server
+// as MODEL_DIR in place of the /mnt mount. Resource limits are not applied.
+type ProcessRuntime struct {
+	// Python is the interpreter running the model server, it needs the packages of the template installed.
+	Python string
+
+	mu          sync.Mutex
+	nextId      int
+	images      map[string]processImage
+	processes   map[string]*process
+	subscribers map[chan ContainerEvent]struct{}
+}
+
+// processImage is the model folder a process is started in, identified by the tag it was built with.
+type processImage struct {
+	dir     string
+	labels  map[string]string
+	created time.Time
+}
+
+type process struct {
+	options StartOptions
+	dir     string
+	cmd     *exec.Cmd
+	running bool
+	// stopping is set while the process is stopped on purpose, so its exit is not reported as a crash
+	stopping bool
+	exited   chan struct{}
+	logs     []processLogLine
+	logged   int
+	// updated is closed and replaced whenever a line is logged or the process exits
+	updated chan struct{}
+}
+
+type processLogLine struct {
+	// seq numbers the lines of a process, starting with 1
+	seq    int
+	stderr bool
+	time   time.Time
+	line   string
+}
+
+// NewProcessRuntime uses COMPANION_PYTHON as interpreter, python3 if it is not set.
+func NewProcessRuntime() *ProcessRuntime {
+	python := os.Getenv("COMPANION_PYTHON")
+	if python == "" {
+		python = "python3"
+	}
+	return &ProcessRuntime{
+		Python:      python,
+		images:      make(map[string]processImage),
+		processes:   make(map[string]*process),
+		subscribers: make(map[chan ContainerEvent]struct{}),
+	}
+}
+
+func (p *ProcessRuntime) Build(ctx context.Context, buildContextPath string, tags []string, labels map[string]string, out io.Writer) error {
+	dir, err := filepath.Abs(buildContextPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.py")); err != nil {
+		return fmt.Errorf("no model server in %s: %w", dir, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, tag := range tags {
+		p.images[tag] = processImage{dir: dir, labels: labels, created: time.Now()}
+		if _, err := fmt.Fprintf(out, "%s runs %s\n", tag, filepath.Join(dir, "app.py")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ProcessRuntime) ImageExists(ctx context.Context, tag string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.images[tag]
+	return ok, nil
+}
+
+// Images returns every tag as an image of its own, the tag is also its id.
+func (p *ProcessRuntime) Images(ctx context.Context) ([]ImageStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var statuses []ImageStatus
+	for tag, image := range p.images {
+		if _, ok := image.labels[LabelModelId]; ok {
+			statuses = append(statuses, ImageStatus{Id: tag, Tags: []string{tag}, Labels: image.labels, Created: image.created})
+		}
+	}
+	return statuses, nil
+}
+
+// RemoveImage only forgets the tag, the model folder is left alone.
+func (p *ProcessRuntime) RemoveImage(ctx context.Context, imageId string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.images[imageId]; !ok {
+		return notFound("remove image", "no such image: %s", imageId)
+	}
+	for id, proc := range p.processes {
+		if proc.options.Image == imageId {
+			return fmt.Errorf("image %s is being used by process %s", imageId, id)
+		}
+	}
+	delete(p.images, imageId)
+	return nil
+}
+
+func (p *ProcessRuntime) Start(ctx context.Context, options StartOptions) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	image, ok := p.images[options.Image]
+	if !ok {
+		return "", fmt.Errorf("image %s was not built", options.Image)
+	}
+
+	p.nextId++
+	id := fmt.Sprintf("process-%d", p.nextId)
+	proc := &process{options: options, dir: image.dir, updated: make(chan struct{})}
+	p.processes[id] = proc
+	if err := p.spawn(id, proc); err != nil {
+		delete(p.processes, id)
+		return "", err
+	}
+	return id, nil
+}
+
+// spawn has to be called with the lock held.
+func (p *ProcessRuntime) spawn(id string, proc *process) error {
+	cmd := exec.Command(p.Python, "-m", "flask", "run", "--host=127.0.0.1", "--port="+proc.options.Port)
+	cmd.Dir = proc.dir
+	cmd.Env = append(os.Environ(), "FLASK_APP=app.py", "MODEL_DIR="+proc.dir, "PYTHONUNBUFFERED=1")
+	cmd.Stdout = &processLogWriter{runtime: p, process: proc}
+	cmd.Stderr = &processLogWriter{runtime: p, process: proc, stderr: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	proc.cmd = cmd
+	proc.running = true
+	proc.stopping = false
+	proc.exited = make(chan struct{})
+	go p.supervise(id, proc, cmd)
+	return nil
+}
+
+// supervise waits for the process to exit and reports it like docker reports a container which died.
+func (p *ProcessRuntime) supervise(id string, proc *process, cmd *exec.Cmd) {
+	err := cmd.Wait()
+	exitCode := 0
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		exitCode = exitError.ExitCode()
+	} else if err != nil {
+		log.Printf("process %s failed: %v", id, err)
+		exitCode = -1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	proc.running = false
+	p.emit(id, EventDie, exitCode)
+	if proc.stopping {
+		p.emit(id, EventStop, exitCode)
+	}
+	close(proc.exited)
+	proc.notify()
+}
+
+func (p *ProcessRuntime) Stop(ctx context.Context, containerId string) error {
+	p.mu.Lock()
+	proc, ok := p.processes[containerId]
+	if !ok {
+		p.mu.Unlock()
+		return notFound("stop", "no such process: %s", containerId)
+	}
+	if !proc.running {
+		p.mu.Unlock()
+		return nil
+	}
+	proc.stopping = true
+	cmd, exited := proc.cmd, proc.exited
+	p.mu.Unlock()
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		_ = cmd.Process.Kill()
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(processStopTimeout):
+	case <-ctx.Done():
+	}
+	if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-exited
+	return nil
+}
+
+func (p *ProcessRuntime) Remove(ctx context.Context, containerId string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, ok := p.processes[containerId]
+	if !ok {
+		return notFound("remove", "no such process: %s", containerId)
+	}
+	if proc.running {
+		return fmt.Errorf("process %s is running", containerId)
+	}
+	delete(p.processes, containerId)
+	return nil
+}
+
+func (p *ProcessRuntime) Restart(ctx context.Context, containerId string) error {
+	if err := p.Stop(ctx, containerId); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.spawn(containerId, p.processes[containerId])
+}
+
+func (p *ProcessRuntime) Inspect(ctx context.Context, containerId string) (ContainerStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, ok := p.processes[containerId]
+	if !ok {
+		return ContainerStatus{}, notFound("inspect", "no such process: %s", containerId)
+	}
+	return proc.status(containerId), nil
+}
+
+// List only knows the processes started by this server, they do not outlive it.
+func (p *ProcessRuntime) List(ctx context.Context) ([]ContainerStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var statuses []ContainerStatus
+	for id, proc := range p.processes {
+		if _, ok := proc.options.Labels[LabelModelId]; ok {
+			statuses = append(statuses, proc.status(id))
+		}
+	}
+	return statuses, nil
+}
+
+func (proc *process) status(id string) ContainerStatus {
+	return ContainerStatus{
+		Id:      id,
+		Ip:      "127.0.0.1",
+		Address: "127.0.0.1:" + proc.options.Port,
+		Running: proc.running,
+		Image:   proc.options.Image,
+		Labels:  proc.options.Labels,
+	}
+}
+
+func (p *ProcessRuntime) Logs(ctx context.Context, containerId string, options LogOptions, stdout io.Writer, stderr io.Writer) error {
+	p.mu.Lock()
+	proc, ok := p.processes[containerId]
+	if !ok {
+		p.mu.Unlock()
+		return notFound("logs", "no such process: %s", containerId)
+	}
+	var lines []processLogLine
+	for _, line := range proc.logs {
+		if !line.time.Before(options.Since) {
+			lines = append(lines, line)
+		}
+	}
+	lines = lines[options.tailStart(len(lines)):]
+	last := proc.logged
+	updated, running := proc.updated, proc.running
+	p.mu.Unlock()
+
+	for {
+		for _, line := range lines {
+			w := stdout
+			if line.stderr {
+				w = stderr
+			}
+			if _, err := io.WriteString(w, line.line+"\n"); err != nil {
+				return err
+			}
+		}
+		if !options.Follow || !running {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-updated:
+		}
+
+		p.mu.Lock()
+		lines = nil
+		for _, line := range proc.logs {
+			if line.seq > last {
+				lines = append(lines, line)
+			}
+		}
+		last = proc.logged
+		updated, running = proc.updated, proc.running
+		p.mu.Unlock()
+	}
+}
+
+func (p *ProcessRuntime) Events(ctx context.Context, handle func(event ContainerEvent)) error {
+	events := make(chan ContainerEvent, 16)
+	p.mu.Lock()
+	p.subscribers[events] = struct{}{}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.subscribers, events)
+		p.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			handle(event)
+		}
+	}
+}
+
+// emit has to be called with the lock held.
+func (p *ProcessRuntime) emit(containerId string, action string, exitCode int) {
+	event := ContainerEvent{
+		ContainerId: containerId,
+		Action:      action,
+		ExitCode:    exitCode,
+		Labels:      p.processes[containerId].options.Labels,
+		Time:        time.Now(),
+	}
+	for subscriber := range p.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// notify has to be called with the lock of the runtime held.
+func (proc *process) notify() {
+	close(proc.updated)
+	proc.updated = make(chan struct{})
+}
+
+// processLogWriter splits the output of a process into lines and keeps the latest maxProcessLogLines of them.
+type processLogWriter struct {
+	runtime *ProcessRuntime
+	process *process
+	stderr  bool
+	partial []byte
+}
+
+func (w *processLogWriter) Write(b []byte) (int, error) {
+	w.runtime.mu.Lock()
+	defer w.runtime.mu.Unlock()
+
+	w.partial = append(w.partial, b...)
+	logged := false
+	for {
+		index := bytes.IndexByte(w.partial, '\n')
+		if index < 0 {
+			break
+		}
+		w.process.logged++
+		w.process.logs = append(w.process.logs, processLogLine{seq: w.process.logged, stderr: w.stderr, time: time.Now(), line: string(w.partial[:index])})
+		w.partial = w.partial[index+1:]
+		logged = true
+	}
+	if len(w.process.logs) > maxProcessLogLines {
+		w.process.logs = w.process.logs[len(w.process.logs)-maxProcessLogLines:]
+	}
+	if logged {
+		w.process.notify()
+	}
+	return len(b), nil
+}
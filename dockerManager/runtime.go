@@ -0,0 +1,132 @@
+package dockerManager
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Runtime is the backend the model containers are built and run on. The handlers only talk to this interface,
+// which allows swapping docker for the in-memory FakeRuntime in tests or on machines without a docker daemon.
+type Runtime interface {
+	// Build builds the image in buildContextPath and tags and labels it. The build output is written to out, a
+	// failing build step results in an error.
+	Build(ctx context.Context, buildContextPath string, tags []string, labels map[string]string, out io.Writer) error
+	// ImageExists reports whether an image with the given tag exists.
+	ImageExists(ctx context.Context, tag string) (bool, error)
+	// Images returns all images which carry the LabelModelId label.
+	Images(ctx context.Context) ([]ImageStatus, error)
+	// RemoveImage removes the image with the given id together with its tags.
+	RemoveImage(ctx context.Context, imageId string) error
+	// Start creates and starts a container as described by the options and returns its id.
+	Start(ctx context.Context, options StartOptions) (string, error)
+	// Stop stops the container with the given id.
+	Stop(ctx context.Context, containerId string) error
+	// Remove removes a stopped container.
+	Remove(ctx context.Context, containerId string) error
+	// Restart restarts a stopped or crashed container, it keeps its id and address.
+	Restart(ctx context.Context, containerId string) error
+	// Inspect returns the current status of the container with the given id.
+	Inspect(ctx context.Context, containerId string) (ContainerStatus, error)
+	// Logs writes the output of the container to stdout and stderr. With LogOptions.Follow it blocks and keeps
+	// writing until ctx is cancelled or the container stops.
+	Logs(ctx context.Context, containerId string, options LogOptions, stdout io.Writer, stderr io.Writer) error
+	// List returns all containers, running or not, which carry the LabelModelId label.
+	List(ctx context.Context) ([]ContainerStatus, error)
+	// Events calls handle for every die, oom and stop event of a model container. It blocks until ctx is cancelled or
+	// the event stream breaks.
+	Events(ctx context.Context, handle func(event ContainerEvent)) error
+}
+
+// Actions of a ContainerEvent.
+const (
+	EventDie  = "die"
+	EventOom  = "oom"
+	EventStop = "stop"
+)
+
+type ContainerEvent struct {
+	ContainerId string
+	Action      string
+	// ExitCode is only set for die events.
+	ExitCode int
+	Labels   map[string]string
+	Time     time.Time
+}
+
+// Labels which are attached to every model container, so the containers can be recognized after a server restart.
+const (
+	LabelModelId = "companionai.model-id"
+	LabelVersion = "companionai.version"
+	LabelPort    = "companionai.port"
+)
+
+type StartOptions struct {
+	Image           string
+	SourceMountPath string
+	TargetMountPath string
+	Port            string
+	Labels          map[string]string
+	Resources       ResourceLimits
+}
+
+// ResourceLimits of a container, zero values mean unlimited.
+type ResourceLimits struct {
+	NanoCpus  int64
+	Memory    int64
+	PidsLimit int64
+}
+
+type LogOptions struct {
+	// Tail is the number of lines from the end of the logs, empty or "all" returns everything.
+	Tail string
+	// Since only returns logs newer than the given point in time.
+	Since  time.Time
+	Follow bool
+}
+
+// tailStart returns the index of the first of n log lines which is part of the tail. Negative tails count as 0.
+func (o LogOptions) tailStart(n int) int {
+	tail, err := strconv.Atoi(o.Tail)
+	if err != nil || tail >= n {
+		return 0
+	}
+	if tail < 0 {
+		return n
+	}
+	return n - tail
+}
+
+type ContainerStatus struct {
+	Id string
+	Ip string
+	// Address is the host:port under which the server can reach the model server inside the container.
+	Address string
+	Running bool
+	// Image is the image the container was started from, as given when it was started.
+	Image  string
+	Labels map[string]string
+}
+
+type ImageStatus struct {
+	Id      string
+	Tags    []string
+	Labels  map[string]string
+	Created time.Time
+	Size    int64
+}
+
+// ImageLabels returns the labels identifying the image of a model.
+func ImageLabels(modelId string) map[string]string {
+	return map[string]string{LabelModelId: modelId}
+}
+
+// ModelLabels returns the labels identifying a container of the given model version listening on port.
+func ModelLabels(modelId string, version string, port string) map[string]string {
+	return map[string]string{
+		LabelModelId: modelId,
+		LabelVersion: version,
+		LabelPort:    port,
+	}
+}
@@ -0,0 +1,109 @@
+package groups
+
+import (
+	"companionAI/helper"
+	"companionAI/lifecycle"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetContainerDrift godoc
+// @Tags admin
+// @Summary get container drift
+// @Description returns the differences found by the latest reconciliation of the tracker with the running containers
+// @Accept json
+// @Produce json
+// @Success 200 {object} lifecycle.DriftReport
+// @Router /admin/containers/drift [get]
+func GetContainerDrift(c *gin.Context) {
+	c.JSON(http.StatusOK, lifecycle.LastDriftReport())
+}
+
+// ReconcileContainers godoc
+// @Tags admin
+// @Summary reconcile containers
+// @Description rebuilds the container tracker from the labelled containers of the runtime
+// @Accept json
+// @Produce json
+// @Success 200 {object} lifecycle.DriftReport
+// @Router /admin/containers/reconcile [post]
+func ReconcileContainers(c *gin.Context) {
+	report, err := lifecycle.Reconcile(c.Request.Context())
+	if err != nil {
+		c.JSON(runtimeErrorStatus(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetGarbageReport godoc
+// @Tags admin
+// @Summary get garbage report
+// @Description returns the images and containers removed by the latest garbage collection
+// @Accept json
+// @Produce json
+// @Success 200 {object} lifecycle.GarbageReport
+// @Router /admin/gc [get]
+func GetGarbageReport(c *gin.Context) {
+	c.JSON(http.StatusOK, lifecycle.LastGarbageReport())
+}
+
+// CollectGarbage godoc
+// @Tags admin
+// @Summary collect garbage
+// @Description removes stopped containers and the images of deleted models or superseded builds
+// @Param        dryRun   query      bool  false  "only reports what would be removed"
+// @Accept json
+// @Produce json
+// @Success 200 {object} lifecycle.GarbageReport
+// @Router /admin/gc [post]
+func CollectGarbage(c *gin.Context) {
+	dryRun := false
+	if value := c.Query("dryRun"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	report, err := lifecycle.CollectGarbage(c.Request.Context(), dryRun)
+	if err != nil {
+		c.JSON(runtimeErrorStatus(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// GetCacheStats godoc
+// @Tags admin
+// @Summary get prediction cache stats
+// @Description returns the size of the prediction cache and its hit and miss counters
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.CacheStats
+// @Router /admin/cache [get]
+func GetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, helper.GetPredictionCache().Stats())
+}
+
+// ClearCache godoc
+// @Tags admin
+// @Summary clear prediction cache
+// @Description removes all cached predictions, or only those of a model
+// @Param        modelId   query      string  false  "only predictions of this model"
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.CacheStats
+// @Router /admin/cache [delete]
+func ClearCache(c *gin.Context) {
+	if modelId := c.Query("modelId"); modelId != "" {
+		helper.GetPredictionCache().InvalidateModel(modelId)
+	} else {
+		helper.GetPredictionCache().Clear()
+	}
+	c.JSON(http.StatusOK, helper.GetPredictionCache().Stats())
+}
@@ -0,0 +1,121 @@
+package groups
+
+import (
+	"bufio"
+	"companionAI/helper"
+	"companionAI/lifecycle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchSize is the maximum number of sentences of one batch.
+const maxBatchSize = 10000
+
+const ndjsonContentType = "application/x-ndjson"
+
+// PredictBatch godoc
+// @Tags model
+// @Summary predict a batch of sentences
+// @Description predicts many sentences with the ready containers of the model version in one request. The sentences are sent as json or as ndjson with one helper.SentenceBody per line, the results keep their order and are returned as json array or streamed as ndjson.
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param        modelVersion   path      string  true  "version for the machine learning model"
+// @Param        concurrency   query      int  false  "number of predictions running at the same time, default 8"
+// @Param        format   query      string  false  "json or ndjson, defaults to the Accept header"
+// @Param data body helper.BatchBody true "sentences"
+// @Accept json
+// @Produce json
+// @Success 200 {array} lifecycle.BatchResult
+// @Router /model/{modelId}/{modelVersion}/batch [post]
+func PredictBatch(c *gin.Context) {
+	modelId := c.Param("modelId")
+	version := c.Param("modelVersion")
+
+	concurrency, err := strconv.Atoi(c.DefaultQuery("concurrency", "8"))
+	if err != nil || concurrency < 1 || concurrency > lifecycle.MaxBatchConcurrency {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("concurrency has to be between 1 and %d", lifecycle.MaxBatchConcurrency))
+		return
+	}
+
+	sentences, err := readSentences(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(sentences) > maxBatchSize {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("a batch can contain at most %d sentences", maxBatchSize))
+		return
+	}
+	if !allowPredictions(c, len(sentences)) {
+		return
+	}
+
+	streamed := c.Query("format") == "ndjson" || (c.Query("format") == "" && strings.Contains(c.GetHeader("Accept"), ndjsonContentType))
+	if !streamed {
+		results := make([]lifecycle.BatchResult, 0, len(sentences))
+		err := lifecycle.PredictBatch(c.Request.Context(), modelId, version, sentences, concurrency, func(result lifecycle.BatchResult) {
+			results = append(results, result)
+		})
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, results)
+		return
+	}
+
+	started := false
+	encoder := json.NewEncoder(c.Writer)
+	err = lifecycle.PredictBatch(c.Request.Context(), modelId, version, sentences, concurrency, func(result lifecycle.BatchResult) {
+		if !started {
+			c.Header("Content-Type", ndjsonContentType)
+			c.Status(http.StatusOK)
+			started = true
+		}
+		if err := encoder.Encode(result); err == nil {
+			c.Writer.Flush()
+		}
+	})
+	if err != nil && !started {
+		c.JSON(http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if !started {
+		// an empty batch
+		c.Header("Content-Type", ndjsonContentType)
+		c.Status(http.StatusOK)
+	}
+}
+
+// readSentences reads a helper.BatchBody, or one helper.SentenceBody per line for ndjson.
+func readSentences(c *gin.Context) ([]string, error) {
+	if !strings.HasPrefix(c.ContentType(), ndjsonContentType) {
+		var batch helper.BatchBody
+		if err := json.NewDecoder(c.Request.Body).Decode(&batch); err != nil {
+			return nil, err
+		}
+		return batch.Sentences, nil
+	}
+
+	var sentences []string
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var sentence helper.SentenceBody
+		if err := json.Unmarshal(scanner.Bytes(), &sentence); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		sentences = append(sentences, sentence.Sentence)
+		if len(sentences) > maxBatchSize {
+			break
+		}
+	}
+	return sentences, scanner.Err()
+}
@@ -0,0 +1,116 @@
+package groups
+
+import (
+	"companionAI/lifecycle"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BuildModel godoc
+// @Tags builds
+// @Summary build model image
+// @Description starts building the image of a model in the background, unchanged models reuse their image
+// @Param        modelId   path      string  true  "unique id for models"
+// @Accept json
+// @Produce json
+// @Success 202 {object} lifecycle.BuildInfo
+// @Router /model/{modelId}/build [post]
+func BuildModel(c *gin.Context) {
+	modelId := c.Param("modelId")
+
+	build, err := lifecycle.BuildModelImage(c.Request.Context(), modelId)
+	if err != nil {
+		c.JSON(runtimeErrorStatus(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, build.Info())
+}
+
+// GetBuilds godoc
+// @Tags builds
+// @Summary get builds
+// @Description returns the running and recently finished image builds
+// @Accept json
+// @Produce json
+// @Success 200 {array} lifecycle.BuildInfo
+// @Router /builds [get]
+func GetBuilds(c *gin.Context) {
+	c.JSON(http.StatusOK, lifecycle.GetBuilds())
+}
+
+// GetBuild godoc
+// @Tags builds
+// @Summary get build
+// @Description returns the status of an image build
+// @Param        buildId   path      string  true  "id of the build"
+// @Accept json
+// @Produce json
+// @Success 200 {object} lifecycle.BuildInfo
+// @Router /builds/{buildId} [get]
+func GetBuild(c *gin.Context) {
+	build, ok := lifecycle.GetBuild(c.Param("buildId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, "build does not exist")
+		return
+	}
+	c.JSON(http.StatusOK, build.Info())
+}
+
+// StreamBuildLogs godoc
+// @Tags builds
+// @Summary stream build logs
+// @Description streams the log lines of an image build as server-sent events, the last event carries the build status
+// @Param        buildId   path      string  true  "id of the build"
+// @Produce text/event-stream
+// @Success 200 {string} log
+// @Router /builds/{buildId}/logs [get]
+func StreamBuildLogs(c *gin.Context) {
+	build, ok := lifecycle.GetBuild(c.Param("buildId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, "build does not exist")
+		return
+	}
+
+	lines, next, unsubscribe := build.Subscribe()
+	defer unsubscribe()
+
+	for _, line := range lines {
+		c.SSEvent("log", line)
+	}
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case line, ok := <-next:
+			if !ok {
+				c.SSEvent("status", build.Info())
+				return false
+			}
+			c.SSEvent("log", line)
+			return true
+		}
+	})
+}
+
+// CancelBuild godoc
+// @Tags builds
+// @Summary cancel build
+// @Description cancels a running image build
+// @Param        buildId   path      string  true  "id of the build"
+// @Accept json
+// @Produce json
+// @Success 200 {object} lifecycle.BuildInfo
+// @Router /builds/{buildId} [delete]
+func CancelBuild(c *gin.Context) {
+	build, ok := lifecycle.GetBuild(c.Param("buildId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, "build does not exist")
+		return
+	}
+
+	build.Cancel()
+	_ = build.Wait(c.Request.Context())
+	c.JSON(http.StatusOK, build.Info())
+}
@@ -0,0 +1,139 @@
+package groups
+
+import (
+	"bytes"
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCachedBody is the size of the largest prediction which is cached.
+const maxCachedBody = 1024 * 1024
+
+// cacheHeader tells the client whether the prediction came from the cache.
+const cacheHeader = "X-Cache"
+
+// recordingWriter passes the answer of the model server through and keeps a copy of the body for the cache.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(data string) (int, error) {
+	w.record([]byte(data))
+	return w.ResponseWriter.WriteString(data)
+}
+
+func (w *recordingWriter) record(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > maxCachedBody {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+// predictionRequest follows a prediction request through the cache and the capture.
+type predictionRequest struct {
+	modelId string
+	version string
+	body    []byte
+	// key is the key of the answer in the prediction cache, it is empty if the cache is disabled or bypassed.
+	key string
+	// generation of the model in the prediction cache when the request arrived.
+	generation uint64
+	// capture is nil if the predictions of the model are not captured.
+	capture *helper.CaptureConfig
+	// shadow is the version which gets a copy of the prediction, it is empty if no copy is sent.
+	shadow  string
+	started time.Time
+}
+
+// lookupPrediction answers the request from the prediction cache if possible. Otherwise the returned request is
+// passed on to proxyPrediction. The cache is bypassed with Cache-Control: no-cache.
+func lookupPrediction(c *gin.Context, modelId string, version string, shadow string) (*predictionRequest, bool) {
+	request := &predictionRequest{modelId: modelId, version: version, capture: captureConfig(modelId), shadow: shadow, started: time.Now()}
+
+	cache := helper.GetPredictionCache()
+	bypass := strings.Contains(c.GetHeader("Cache-Control"), "no-cache")
+	if (!cache.Enabled() || bypass) && request.capture == nil && request.shadow == "" {
+		return request, false
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return nil, true
+	}
+	// the body is read again when the request is proxied
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	request.body = body
+
+	if !cache.Enabled() {
+		return request, false
+	}
+	if bypass {
+		c.Header(cacheHeader, "BYPASS")
+		return request, false
+	}
+
+	request.key = helper.CacheKey(modelId, version, body)
+	request.generation = cache.Generation(modelId)
+	if prediction, ok := cache.Get(request.key); ok {
+		c.Header(cacheHeader, "HIT")
+		c.Data(http.StatusOK, prediction.ContentType, prediction.Body)
+		capturePrediction(request, "", http.StatusOK, prediction.Body, true)
+		mirrorPrediction(request, http.StatusOK, prediction.Body)
+		return request, true
+	}
+	c.Header(cacheHeader, "MISS")
+	return request, false
+}
+
+// proxyPrediction proxies the prediction request to the container, caches successful answers, captures the prediction
+// and sends a copy to the shadow version.
+func proxyPrediction(c *gin.Context, request *predictionRequest, containerId string, information dockerManager.ContainerInformation) {
+	if request.key == "" && request.capture == nil && request.shadow == "" {
+		proxyRequest(c, containerId, information, http.MethodPost, "/predict")
+		return
+	}
+
+	writer := &recordingWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	defer func() { c.Writer = writer.ResponseWriter }()
+
+	proxyRequest(c, containerId, information, http.MethodPost, "/predict")
+
+	var answer []byte
+	if !writer.overflow {
+		answer = writer.body.Bytes()
+	}
+	capturePrediction(request, containerId, writer.Status(), answer, false)
+	mirrorPrediction(request, writer.Status(), answer)
+
+	if request.key == "" || writer.Status() != http.StatusOK || writer.overflow {
+		return
+	}
+	helper.GetPredictionCache().Put(helper.CachedPrediction{
+		Key:         request.key,
+		ModelId:     information.ModelId,
+		Version:     information.Version,
+		ContentType: writer.Header().Get("Content-Type"),
+		Body:        answer,
+		CreatedAt:   time.Now(),
+	}, request.generation)
+}
@@ -0,0 +1,312 @@
+package groups
+
+import (
+	"companionAI/helper"
+	"companionAI/utils"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCapturePageSize is the maximum number of captured predictions returned at once.
+const maxCapturePageSize = 1000
+
+// captureConfig returns the capture configuration of the model, or nil if its predictions are not captured.
+func captureConfig(modelId string) *helper.CaptureConfig {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	config, err := utils.LoadConfig(dir, modelId)
+	if err != nil || config.Capture == nil || !config.Capture.Enabled {
+		return nil
+	}
+	return config.Capture
+}
+
+// capturePrediction appends the prediction to the capture of the model if it is enabled. Failures are only logged,
+// the prediction was answered anyway.
+func capturePrediction(request *predictionRequest, containerId string, status int, answer []byte, cached bool) {
+	if request.capture == nil {
+		return
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		log.Println("could not capture prediction:", err)
+		return
+	}
+	prediction := helper.CapturedPrediction{
+		Id:          hex.EncodeToString(id),
+		Time:        request.started,
+		ModelId:     request.modelId,
+		Version:     request.version,
+		ContainerId: containerId,
+		Cached:      cached,
+		LatencyMs:   float64(time.Since(request.started).Microseconds()) / 1000,
+		Status:      status,
+		Request:     rawJson(request.body),
+		Response:    rawJson(answer),
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Println("could not capture prediction:", err)
+		return
+	}
+	if err := utils.AppendCapture(dir, request.modelId, *request.capture, prediction); err != nil {
+		log.Printf("could not capture prediction of model %s: %v", request.modelId, err)
+	}
+}
+
+// rawJson keeps json as it is and turns everything else, e.g. error messages of the model server, into a json string.
+func rawJson(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	if json.Valid(data) {
+		return append(json.RawMessage(nil), data...)
+	}
+	quoted, _ := json.Marshal(string(data))
+	return quoted
+}
+
+// SetCapture godoc
+// @Tags capture
+// @Summary set prediction capture
+// @Description turns the capture of the predict requests and answers of a model on or off. The predictions are appended to captures/predictions.jsonl in the model folder, which is rotated by size.
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param data body helper.CaptureConfig true "sizes default to 10MB per file and 5 files"
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.CaptureConfig
+// @Router /model/{modelId}/capture [post]
+func SetCapture(c *gin.Context) {
+	modelId := c.Param("modelId")
+	dir, err := os.Getwd()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var capture helper.CaptureConfig
+	decoder := json.NewDecoder(c.Request.Body)
+	err = decoder.Decode(&capture)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = utils.SetCapture(dir, modelId, capture)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, capture)
+}
+
+// GetCaptures godoc
+// @Tags capture
+// @Summary get captured predictions
+// @Description returns the captured predictions of a model, the newest first
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param        version   query      string  false  "only predictions of this version"
+// @Param        since   query      string  false  "only predictions at or after this time, RFC 3339"
+// @Param        until   query      string  false  "only predictions before this time, RFC 3339"
+// @Param        offset   query      int  false  "number of predictions to skip, default 0"
+// @Param        limit   query      int  false  "number of predictions, default 100"
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.CapturePage
+// @Router /model/{modelId}/captures [get]
+func GetCaptures(c *gin.Context) {
+	modelId := c.Param("modelId")
+	version := c.Query("version")
+
+	var since, until time.Time
+	var err error
+	if value := c.Query("since"); value != "" {
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if value := c.Query("until"); value != "" {
+		if until, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, "offset has to be a positive number")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > maxCapturePageSize {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("limit has to be between 1 and %d", maxCapturePageSize))
+		return
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	captures, err := utils.LoadCaptures(dir, modelId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	matching := []helper.CapturedPrediction{}
+	for i := len(captures) - 1; i >= 0; i-- {
+		capture := captures[i]
+		if version != "" && capture.Version != version {
+			continue
+		}
+		if (!since.IsZero() && capture.Time.Before(since)) || (!until.IsZero() && !capture.Time.Before(until)) {
+			continue
+		}
+		matching = append(matching, capture)
+	}
+
+	page := helper.CapturePage{Total: len(matching), Offset: offset, Limit: limit, Captures: []helper.CapturedPrediction{}}
+	if offset < len(matching) {
+		end := offset + limit
+		if end > len(matching) {
+			end = len(matching)
+		}
+		page.Captures = matching[offset:end]
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// PromoteCaptures godoc
+// @Tags capture
+// @Summary promote captured predictions
+// @Description adds captured predictions to the trainings-data. The predicted entities are used unless corrected entities are given for the capture, sentences which are already part of the trainings-data are skipped.
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param data body helper.PromoteBody true "ids of the captured predictions"
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.EntityDataPoints
+// @Router /model/{modelId}/captures/promote [post]
+func PromoteCaptures(c *gin.Context) {
+	modelId := c.Param("modelId")
+
+	var promote helper.PromoteBody
+	decoder := json.NewDecoder(c.Request.Body)
+	err := decoder.Decode(&promote)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	captures, err := utils.LoadCaptures(dir, modelId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	capturesById := make(map[string]helper.CapturedPrediction, len(captures))
+	for _, capture := range captures {
+		capturesById[capture.Id] = capture
+	}
+
+	// TODO take correct trainings-data name from config.yml file in data
+	dataPath := dir + "/mnt/models/" + modelId + "/data/trainingsData.json"
+
+	var savedData helper.EntityDataPoints
+	if err := utils.Load(dataPath, &savedData); err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	existing := make(map[string]bool, len(savedData.EntityDataPoints))
+	for _, dataPoint := range savedData.EntityDataPoints {
+		existing[dataPoint.Id] = true
+	}
+
+	promoted := helper.EntityDataPoints{EntityDataPoints: []helper.EntityDataPoint{}}
+	for _, id := range promote.Ids {
+		capture, ok := capturesById[id]
+		if !ok {
+			c.JSON(http.StatusNotFound, fmt.Sprintf("captured prediction %s does not exist", id))
+			return
+		}
+		dataPoint, err := capturedDataPoint(capture, promote.Entities[id])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		if existing[dataPoint.Id] {
+			continue
+		}
+		existing[dataPoint.Id] = true
+		promoted.EntityDataPoints = append(promoted.EntityDataPoints, dataPoint)
+	}
+
+	savedData.EntityDataPoints = append(promoted.EntityDataPoints, savedData.EntityDataPoints...)
+	err = utils.Save(dataPath, savedData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, promoted)
+}
+
+// capturedDataPoint turns a captured prediction into a data point. Without corrected entities the entities are taken
+// from the answer of the model server, which maps every label to the text found in the sentence.
+func capturedDataPoint(capture helper.CapturedPrediction, entities []helper.EntityInformation) (helper.EntityDataPoint, error) {
+	var request helper.SentenceBody
+	if err := json.Unmarshal(capture.Request, &request); err != nil || request.Sentence == "" {
+		return helper.EntityDataPoint{}, fmt.Errorf("captured prediction %s has no sentence", capture.Id)
+	}
+
+	if entities == nil {
+		if capture.Status != http.StatusOK {
+			return helper.EntityDataPoint{}, fmt.Errorf("captured prediction %s failed, the entities have to be given", capture.Id)
+		}
+		var predicted map[string]string
+		if err := json.Unmarshal(capture.Response, &predicted); err != nil {
+			return helper.EntityDataPoint{}, fmt.Errorf("captured prediction %s has no entities: %w", capture.Id, err)
+		}
+		entities = []helper.EntityInformation{}
+		for label, text := range predicted {
+			index := strings.Index(request.Sentence, text)
+			if text == "" || index < 0 {
+				continue
+			}
+			// spacy counts characters, not bytes
+			start := utf8.RuneCountInString(request.Sentence[:index])
+			entities = append(entities, helper.EntityInformation{StartingPosition: start, EndingPosition: start + utf8.RuneCountInString(text), EntityLabel: label})
+		}
+		sort.Slice(entities, func(i, j int) bool {
+			return entities[i].StartingPosition < entities[j].StartingPosition
+		})
+	}
+
+	return helper.EntityDataPoint{
+		Id:       fmt.Sprintf("%x", md5.Sum([]byte(request.Sentence))),
+		Sentence: request.Sentence,
+		Entities: entities,
+	}, nil
+}
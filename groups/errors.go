@@ -0,0 +1,20 @@
+package groups
+
+import (
+	"companionAI/dockerManager"
+	"errors"
+	"net/http"
+)
+
+// runtimeErrorStatus maps the kind of a dockerManager.RuntimeError to a status code, other errors are bad requests.
+func runtimeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, dockerManager.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, dockerManager.ErrDaemonUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, dockerManager.ErrTimeout):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadRequest
+}
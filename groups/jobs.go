@@ -0,0 +1,126 @@
+package groups
+
+import (
+	"companionAI/lifecycle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxJobPageSize is the maximum number of results returned by one page of a job.
+const maxJobPageSize = 1000
+
+// SubmitJob godoc
+// @Tags jobs
+// @Summary submit prediction job
+// @Description queues a prediction job for the sentences which runs in the background, the results are fetched page by page once they are available. The sentences are sent like for a batch.
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param        modelVersion   path      string  true  "version for the machine learning model"
+// @Param        concurrency   query      int  false  "number of predictions running at the same time, default 8"
+// @Param data body helper.BatchBody true "sentences"
+// @Accept json
+// @Produce json
+// @Success 202 {object} lifecycle.JobInfo
+// @Router /model/{modelId}/{modelVersion}/jobs [post]
+func SubmitJob(c *gin.Context) {
+	modelId := c.Param("modelId")
+	version := c.Param("modelVersion")
+
+	concurrency, err := strconv.Atoi(c.DefaultQuery("concurrency", "8"))
+	if err != nil || concurrency < 1 || concurrency > lifecycle.MaxBatchConcurrency {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("concurrency has to be between 1 and %d", lifecycle.MaxBatchConcurrency))
+		return
+	}
+
+	sentences, err := readSentences(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(sentences) > maxBatchSize {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("a job can contain at most %d sentences", maxBatchSize))
+		return
+	}
+	if !allowPredictions(c, len(sentences)) {
+		return
+	}
+
+	job, err := lifecycle.SubmitJob(modelId, version, sentences, concurrency)
+	if errors.Is(err, lifecycle.ErrJobQueueFull) {
+		c.JSON(http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, job.Info())
+}
+
+// GetJobs godoc
+// @Tags jobs
+// @Summary get prediction jobs
+// @Description returns the queued, running and retained prediction jobs, the newest first
+// @Param        modelId   query      string  false  "only jobs of this model"
+// @Accept json
+// @Produce json
+// @Success 200 {array} lifecycle.JobInfo
+// @Router /jobs [get]
+func GetJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, lifecycle.GetJobs(c.Query("modelId")))
+}
+
+// GetJob godoc
+// @Tags jobs
+// @Summary get prediction job
+// @Description returns the status of a prediction job with a page of its results
+// @Param        jobId   path      string  true  "id of the job"
+// @Param        offset   query      int  false  "index of the first result, default 0"
+// @Param        limit   query      int  false  "number of results, default 100"
+// @Accept json
+// @Produce json
+// @Success 200 {object} lifecycle.JobPage
+// @Router /jobs/{jobId} [get]
+func GetJob(c *gin.Context) {
+	job, ok := lifecycle.GetJob(c.Param("jobId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, "job does not exist")
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, "offset has to be a positive number")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > maxJobPageSize {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("limit has to be between 1 and %d", maxJobPageSize))
+		return
+	}
+	c.JSON(http.StatusOK, job.Page(offset, limit))
+}
+
+// CancelJob godoc
+// @Tags jobs
+// @Summary cancel prediction job
+// @Description cancels a queued or running prediction job, the results predicted so far are kept
+// @Param        jobId   path      string  true  "id of the job"
+// @Accept json
+// @Produce json
+// @Success 200 {object} lifecycle.JobInfo
+// @Router /jobs/{jobId} [delete]
+func CancelJob(c *gin.Context) {
+	job, ok := lifecycle.GetJob(c.Param("jobId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, "job does not exist")
+		return
+	}
+
+	job.Cancel()
+	_ = job.Wait(c.Request.Context())
+	c.JSON(http.StatusOK, job.Info())
+}
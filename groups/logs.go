@@ -0,0 +1,138 @@
+package groups
+
+import (
+	"bytes"
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContainerLogs godoc
+// @Tags model
+// @Summary get container logs
+// @Description returns the stdout and stderr lines of a model container, with follow the lines are streamed as server-sent events
+// @Param        containerId   path      string  true  "unique id for the container"
+// @Param        tail   query      string  false  "number of lines from the end of the logs or all"
+// @Param        since   query      string  false  "only newer logs, either a duration like 10m or a RFC 3339 timestamp"
+// @Param        follow   query      bool  false  "keeps streaming new lines"
+// @Produce json
+// @Success 200 {array} helper.LogLine
+// @Router /model/{containerId}/logs [get]
+func ContainerLogs(c *gin.Context) {
+	// gin needs the same wildcard name for all routes below /model, so the container id is found under modelId
+	containerId := c.Param("modelId")
+
+	options := dockerManager.LogOptions{
+		Tail:   c.DefaultQuery("tail", "all"),
+		Follow: c.Query("follow") == "true",
+	}
+	if tail, err := strconv.Atoi(options.Tail); (err != nil && options.Tail != "all") || tail < 0 {
+		c.JSON(http.StatusBadRequest, "tail must be a positive number or all")
+		return
+	}
+	if since := c.Query("since"); since != "" {
+		if duration, err := time.ParseDuration(since); err == nil {
+			options.Since = time.Now().Add(-duration)
+		} else if timestamp, err := time.Parse(time.RFC3339, since); err == nil {
+			options.Since = timestamp
+		} else {
+			c.JSON(http.StatusBadRequest, "since must be a duration or a RFC 3339 timestamp")
+			return
+		}
+	}
+
+	runtime := helper.GetRuntime()
+	status, err := runtime.Inspect(c.Request.Context(), containerId)
+	if err != nil {
+		c.JSON(runtimeErrorStatus(err), err.Error())
+		return
+	}
+	if _, ok := status.Labels[dockerManager.LabelModelId]; !ok {
+		c.JSON(http.StatusNotFound, "container does not belong to a model")
+		return
+	}
+
+	if !options.Follow {
+		lines := make([]helper.LogLine, 0)
+		collect := func(line helper.LogLine) bool {
+			lines = append(lines, line)
+			return true
+		}
+		stdout := &lineWriter{stream: "stdout", emit: collect}
+		stderr := &lineWriter{stream: "stderr", emit: collect}
+		if err := runtime.Logs(c.Request.Context(), containerId, options, stdout, stderr); err != nil {
+			c.JSON(runtimeErrorStatus(err), err.Error())
+			return
+		}
+		stdout.flush()
+		stderr.flush()
+		c.JSON(http.StatusOK, lines)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	lines := make(chan helper.LogLine)
+	send := func(line helper.LogLine) bool {
+		select {
+		case lines <- line:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	go func() {
+		defer close(lines)
+		stdout := &lineWriter{stream: "stdout", emit: send}
+		stderr := &lineWriter{stream: "stderr", emit: send}
+		if err := runtime.Logs(ctx, containerId, options, stdout, stderr); err != nil {
+			send(helper.LogLine{Stream: "error", Line: err.Error()})
+		}
+		stdout.flush()
+		stderr.flush()
+	}()
+
+	c.Stream(func(w io.Writer) bool {
+		line, ok := <-lines
+		if !ok {
+			return false
+		}
+		c.SSEvent(line.Stream, line.Line)
+		return true
+	})
+}
+
+// lineWriter cuts the output of a container stream into lines.
+type lineWriter struct {
+	stream  string
+	emit    func(line helper.LogLine) bool
+	partial []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+	for {
+		index := bytes.IndexByte(l.partial, '\n')
+		if index < 0 {
+			return len(p), nil
+		}
+		if !l.emit(helper.LogLine{Stream: l.stream, Line: string(l.partial[:index])}) {
+			return 0, io.ErrClosedPipe
+		}
+		l.partial = l.partial[index+1:]
+	}
+}
+
+func (l *lineWriter) flush() {
+	if len(l.partial) > 0 {
+		l.emit(helper.LogLine{Stream: l.stream, Line: string(l.partial)})
+		l.partial = nil
+	}
+}
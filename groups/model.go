@@ -3,13 +3,16 @@ package groups
 import (
 	"companionAI/dockerManager"
 	"companionAI/helper"
+	"companionAI/lifecycle"
 	"companionAI/utils"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	cp "github.com/otiai10/copy"
@@ -77,27 +80,71 @@ func CreateNewModel(c *gin.Context) {
 // PredictData godoc
 // @Tags model
 // @Summary predict datapoint
-// @Description generates prediction for the datapoint
+// @Description generates prediction for the datapoint, identical requests are answered from the prediction cache unless sent with Cache-Control: no-cache
 // @Param        modelId   path      string  true  "unique id for models"
 // @Param        modelVersion   path      string  true  "use version v1 if no other versions exist"
 // @Param data body helper.SentenceBody true "prediction sentence"
 // @Accept json
 // @Produce json
-// @Success 200 {string} prediction
+// @Success 200 {object} map[string]string
+// @Failure 502 {object} helper.UpstreamError
+// @Failure 504 {object} helper.UpstreamError
 // @Router /model/predict/{modelId}/{modelVersion} [post]
 func PredictData(c *gin.Context) {
 	// with the model id we can target different functions therefore each model type must be unique at the start
 	containerId := c.Param("containerId")
-	containerTracker := helper.GetContainerTracker()
-	containerInformation, contains := containerTracker[containerId]
+	containerInformation, contains := helper.GetRegistry().Get(containerId)
 	if !contains {
 		c.JSON(http.StatusBadRequest, "ContainerId does not exist")
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:5000/predict", containerInformation.Ip)
+	request, answered := lookupPrediction(c, containerInformation.ModelId, containerInformation.Version, "")
+	if answered {
+		return
+	}
+
+	helper.GetRegistry().BeginRequest(containerId)
+	defer helper.GetRegistry().EndRequest(containerId)
+
+	proxyPrediction(c, request, containerId, containerInformation)
+}
+
+// PredictModelVersion godoc
+// @Tags model
+// @Summary predict datapoint with model version
+// @Description generates a prediction with a ready container of the model version, a container is started and the version loaded if none is running. Identical requests are answered from the prediction cache unless sent with Cache-Control: no-cache
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param        modelVersion   path      string  true  "version for the machine learning model"
+// @Param data body helper.SentenceBody true "prediction sentence"
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 502 {object} helper.UpstreamError
+// @Failure 504 {object} helper.UpstreamError
+// @Router /model/{modelId}/{modelVersion}/predict [post]
+func PredictModelVersion(c *gin.Context) {
+	predictVersion(c, c.Param("modelId"), c.Param("modelVersion"), "")
+}
+
+// predictVersion predicts with a ready container of the version, or answers from the prediction cache.
+func predictVersion(c *gin.Context, modelId string, version string, shadow string) {
+	// cached predictions do not need a running container
+	request, answered := lookupPrediction(c, modelId, version, shadow)
+	if answered {
+		return
+	}
+
+	containerId, containerInformation, err := lifecycle.EnsureReady(c.Request.Context(), modelId, version, lifecycle.DefaultReadinessOptions)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	helper.GetRegistry().BeginRequest(containerId)
+	defer helper.GetRegistry().EndRequest(containerId)
 
-	handleRequest(c, "POST", url, c.Request.Body)
+	proxyPrediction(c, request, containerId, containerInformation)
 }
 
 // TrainModel godoc
@@ -108,44 +155,52 @@ func PredictData(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Success 200 {string} message
+// @Failure 502 {object} helper.UpstreamError
+// @Failure 504 {object} helper.UpstreamError
 // @Router /model/train/{containerId} [put]
 func TrainModel(c *gin.Context) {
 	// TODO handling a training response -> continuous data stream
 	containerId := c.Param("containerId")
-	containerTracker := helper.GetContainerTracker()
-	containerInformation, contains := containerTracker[containerId]
+	containerInformation, contains := helper.GetRegistry().Get(containerId)
 	if !contains {
 		c.JSON(http.StatusBadRequest, "ContainerId does not exist")
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:5000/train", containerInformation.Ip)
+	helper.GetRegistry().BeginRequest(containerId)
+	defer helper.GetRegistry().EndRequest(containerId)
 
-	handleRequest(c, "GET", url, c.Request.Body)
+	proxyRequest(c, containerId, containerInformation, http.MethodGet, "/train")
 }
 
 // LoadModel godoc
 // @Tags model
 // @Summary load model
-// @Description loads the machine learning model in the container
+// @Description loads the machine learning model in the container and invalidates the cached predictions of the model
 // @Param        containerId   path      string  true  "unique id for the container"
 // @Accept json
 // @Produce json
 // @Success 200 {string} message
+// @Failure 502 {object} helper.UpstreamError
+// @Failure 504 {object} helper.UpstreamError
 // @Router /model/load/{containerId} [put]
 func LoadModel(c *gin.Context) {
 	//TODO create function for this:
 	containerId := c.Param("containerId")
-	containerTracker := helper.GetContainerTracker()
-	containerInformation, contains := containerTracker[containerId]
+	containerInformation, contains := helper.GetRegistry().Get(containerId)
 	if !contains {
 		c.JSON(http.StatusBadRequest, "ContainerId does not exist")
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:5000/load/v1", containerInformation.Ip)
+	helper.GetRegistry().BeginRequest(containerId)
+	defer helper.GetRegistry().EndRequest(containerId)
 
-	handleRequest(c, "GET", url, c.Request.Body)
+	proxyRequest(c, containerId, containerInformation, http.MethodGet, "/load/v1")
+	if c.Writer.Status() < http.StatusBadRequest {
+		// the predictions of the previously loaded model are outdated
+		helper.GetPredictionCache().InvalidateModel(containerInformation.ModelId)
+	}
 }
 
 // StartContainer godoc
@@ -154,6 +209,8 @@ func LoadModel(c *gin.Context) {
 // @Description starts a container for a given model
 // @Param        modelId   path      string  true  "unique id for models"
 // @Param        modelVersion   path      string  true  "version for the machine learning model"
+// @Param        wait   query      bool  false  "waits until the model server inside the container is ready and loaded the version"
+// @Param        timeout   query      string  false  "how long to wait for the container to become ready, e.g. 90s"
 // @Accept json
 // @Produce json
 // @Success 200 {object} helper.ContainerInfo
@@ -161,42 +218,95 @@ func LoadModel(c *gin.Context) {
 func StartContainer(c *gin.Context) {
 	version := c.Param("modelVersion")
 	modelId := c.Param("modelId")
-	containerTracker := helper.GetContainerTracker()
 
-	if helper.ContainerAlreadyRunning(modelId, version, containerTracker) {
+	wait := c.Query("wait") == "true"
+	readiness := lifecycle.DefaultReadinessOptions
+	if timeout := c.Query("timeout"); timeout != "" {
+		deadline, err := time.ParseDuration(timeout)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		readiness.Deadline = deadline
+	}
+
+	id, information, err := lifecycle.StartUnlessRunning(c.Request.Context(), modelId, version)
+	if errors.Is(err, lifecycle.ErrAlreadyRunning) {
 		c.JSON(http.StatusOK, "Container with this modelId and version is already running.")
 		return
 	}
+	if err != nil {
+		c.JSON(runtimeErrorStatus(err), err.Error())
+		return
+	}
+	containerInfo := helper.ContainerInfo{Id: id, Ip: information.Ip, Address: information.Address, Port: information.Port, State: dockerManager.StateStarting}
 
-	dir, err := os.Getwd()
+	if !wait {
+		lifecycle.WatchLoading(id, information, version, readiness)
+		c.JSON(http.StatusOK, containerInfo)
+		return
+	}
+
+	// the readiness is tracked to the end, even if the client stops waiting
+	if err := lifecycle.WaitUntilLoaded(context.Background(), id, information, version, readiness); err != nil {
+		c.JSON(http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	containerInfo.State = dockerManager.StateReady
+	c.JSON(http.StatusOK, containerInfo)
+}
+
+// ScaleContainers godoc
+// @Tags model
+// @Summary scale model version
+// @Description starts or stops containers until the given number of replicas serves the model version
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param        modelVersion   path      string  true  "version for the machine learning model"
+// @Param data body helper.ScaleBody true "number of replicas"
+// @Accept json
+// @Produce json
+// @Success 200 {array} helper.ContainerInfo
+// @Router /model/{modelId}/{modelVersion}/scale [post]
+func ScaleContainers(c *gin.Context) {
+	version := c.Param("modelVersion")
+	modelId := c.Param("modelId")
+
+	var scale helper.ScaleBody
+	decoder := json.NewDecoder(c.Request.Body)
+	err := decoder.Decode(&scale)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if scale.Replicas < 0 {
+		c.JSON(http.StatusBadRequest, "replicas can not be negative")
+		return
 	}
 
-	err = dockerManager.Build(dir+"/mnt/models/"+modelId, []string{modelId})
+	dir, err := os.Getwd()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	port := helper.GetNextPort(containerTracker)
-
-	id, err := dockerManager.Start(modelId, os.Args[1]+"/models/"+modelId, "/mnt", port)
-
+	err = utils.SetReplicas(dir, modelId, version, scale.Replicas)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	ip, err := dockerManager.GetContainerIp(id)
+	ids, err := lifecycle.ScaleModel(c.Request.Context(), modelId, version, scale.Replicas, lifecycle.DefaultReadinessOptions)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, fmt.Errorf("error while trying to get containerIp %w", err))
+		c.JSON(runtimeErrorStatus(err), err.Error())
 		return
 	}
 
-	containerTracker[id] = dockerManager.ContainerInformation{Port: port, ModelId: modelId, Version: version, Ip: ip}
-
-	c.JSON(http.StatusOK, helper.ContainerInfo{Id: id, Ip: ip, Port: port})
+	replicas := make([]helper.ContainerInfo, 0, len(ids))
+	for _, id := range ids {
+		information, _ := helper.GetRegistry().Get(id)
+		replicas = append(replicas, helper.ContainerInfo{Id: id, Ip: information.Ip, Address: information.Address, Port: information.Port, State: information.State})
+	}
+	c.JSON(http.StatusOK, replicas)
 }
 
 // GetLabels godoc
@@ -291,6 +401,41 @@ func RemoveLabels(c *gin.Context) {
 	c.JSON(http.StatusOK, "labels were updated")
 }
 
+// SetResources godoc
+// @Tags model
+// @Summary set resources
+// @Description validates and saves the cpu, memory and pids limits for the containers of a model, they apply to containers started afterwards
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param data body helper.Resources true "memory uses docker units, e.g. 2g"
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.Resources
+// @Router /model/{modelId}/resources [post]
+func SetResources(c *gin.Context) {
+	modelId := c.Param("modelId")
+	dir, err := os.Getwd()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var resources helper.Resources
+	decoder := json.NewDecoder(c.Request.Body)
+	err = decoder.Decode(&resources)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = utils.SetResources(dir, modelId, resources)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, resources)
+}
+
 // RemoveModel godoc
 // @Tags model
 // @Summary remove model
@@ -315,6 +460,7 @@ func RemoveModel(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
+	helper.GetPredictionCache().InvalidateModel(modelId)
 
 	c.JSON(http.StatusOK, "model was removed")
 }
@@ -330,15 +476,12 @@ func RemoveModel(c *gin.Context) {
 // @Router /model/{containerId}/stop [put]
 func EndContainer(c *gin.Context) {
 	containerId := c.Param("containerId")
-	err := dockerManager.Stop(containerId)
+	err := lifecycle.StopContainer(c.Request.Context(), containerId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, fmt.Errorf("could not stop container %w", err))
+		c.JSON(runtimeErrorStatus(err), fmt.Sprintf("could not stop container %v", err))
 		return
 	}
 
-	containerTracker := helper.GetContainerTracker()
-	delete(containerTracker, containerId)
-
 	c.JSON(http.StatusOK, "Successfully stopped container!")
 }
 
@@ -367,31 +510,14 @@ func ModelInformation(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, modelInfo)
-}
-
-func handleRequest(c *gin.Context, requestMethod string, url string, payload io.Reader) {
-	client := &http.Client{}
-	req, err := http.NewRequest(requestMethod, url, payload)
+	modelInfo.Crashes = helper.GetCrashes(modelId)
 
-	if err != nil {
-		c.JSON(http.StatusBadRequest, fmt.Errorf("error while creating the request %w", err))
-		return
-	}
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, fmt.Errorf("error while sending the request %w", err))
-		return
+	if modelInfo.Resources != nil {
+		if _, err := utils.ResourceLimits(*modelInfo.Resources); err != nil {
+			c.JSON(http.StatusBadRequest, fmt.Sprintf("invalid resources in config.json: %s", err))
+			return
+		}
 	}
-	defer res.Body.Close()
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		fmt.Println(err)
-		c.JSON(http.StatusBadRequest, fmt.Errorf("error while reading response body %w", err))
-		return
-	}
-	c.JSON(http.StatusOK, string(body))
+	c.JSON(http.StatusOK, modelInfo)
 }
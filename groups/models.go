@@ -1,8 +1,8 @@
 package groups
 
 import (
-	"companionAI/dockerManager"
 	"companionAI/helper"
+	"companionAI/lifecycle"
 	"companionAI/utils"
 	"io/ioutil"
 	"net/http"
@@ -64,12 +64,11 @@ func GetModelTypes(c *gin.Context) {
 // @Success 200 {string} message
 // @Router /models/stopAll [put]
 func StopAllContainer(c *gin.Context) {
-	containerTracker := helper.GetContainerTracker()
-	err := dockerManager.StopAll(containerTracker)
+	err := lifecycle.StopAll(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err.Error())
+		c.JSON(runtimeErrorStatus(err), err.Error())
+		return
 	}
-	helper.ResetContainerTracker()
 	c.JSON(http.StatusOK, "Stopped all containers")
 }
 
@@ -82,6 +81,6 @@ func StopAllContainer(c *gin.Context) {
 // @Success 200 {object} dockerManager.ContainerInformation
 // @Router /models/runningContainers [get]
 func GetRunningContainers(c *gin.Context) {
-	containerTracker := helper.GetContainerTracker()
+	containerTracker := helper.GetRegistry().All()
 	c.JSON(http.StatusOK, containerTracker)
 }
@@ -0,0 +1,72 @@
+package groups
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// proxyTransport is shared by all proxied requests, so connections to the containers are reused. The model servers
+// only start to answer after the work is done, except for the streamed training.
+var proxyTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConnsPerHost:   16,
+	IdleConnTimeout:       90 * time.Second,
+	ResponseHeaderTimeout: 2 * time.Minute,
+}
+
+// proxyRequest forwards the request to path on the model server of the container with the given method. Status
+// code, headers and body of the answer are passed through as they are, the body is streamed. Containers which can not
+// be reached result in 502, or 504 if they did not answer in time.
+func proxyRequest(c *gin.Context, containerId string, information dockerManager.ContainerInformation, method string, path string) {
+	target, err := url.Parse(helper.ContainerUrl(information, path))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Transport: proxyTransport,
+		// flush right away, training answers with server-sent events
+		FlushInterval: -1,
+		Director: func(req *http.Request) {
+			req.URL = target
+			req.Host = target.Host
+			req.Method = method
+			if method == http.MethodGet {
+				req.Body = http.NoBody
+				req.ContentLength = 0
+			} else if req.Header.Get("Content-Type") == "" {
+				// flask only parses json bodies which are declared as such
+				req.Header.Set("Content-Type", "application/json")
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			if errors.Is(err, context.Canceled) {
+				// the client went away, nobody is left to answer
+				return
+			}
+			log.Printf("request to container %s failed: %v", containerId, err)
+
+			status := http.StatusBadGateway
+			var netError net.Error
+			if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netError) && netError.Timeout()) {
+				status = http.StatusGatewayTimeout
+			}
+			c.JSON(status, helper.UpstreamError{Error: err.Error(), ContainerId: containerId, Url: target.String()})
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,179 @@
+package groups
+
+import (
+	"companionAI/helper"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientHeader identifies the API client if the server trusts it, otherwise clients are limited by their ip address.
+const clientHeader = "X-Client-Id"
+
+func clientOf(c *gin.Context) string {
+	if client := c.GetHeader(clientHeader); client != "" && helper.TrustsClientId() {
+		return client
+	}
+	return c.ClientIP()
+}
+
+// modelOf returns the model a request is for, either from the path or from the container it targets.
+func modelOf(c *gin.Context) string {
+	if modelId := c.Param("modelId"); modelId != "" {
+		return modelId
+	}
+	if information, ok := helper.GetRegistry().Get(c.Param("containerId")); ok {
+		return information.ModelId
+	}
+	return ""
+}
+
+// tooManyRequests aborts the request with 429, Retry-After is given in whole seconds.
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, message)
+}
+
+// RateLimit takes a token from the bucket of the client and the model for every request.
+func RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !allowPredictions(c, 1) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// allowPredictions takes a token for every sentence of the request, batches and jobs call it once their sentences
+// are read. The request is aborted with 429 if the client has to wait.
+func allowPredictions(c *gin.Context, sentences int) bool {
+	if ok, wait := helper.GetRateLimiter().AllowPrediction(clientOf(c), modelOf(c), sentences); !ok {
+		tooManyRequests(c, wait, "too many predictions, retry later")
+		return false
+	}
+	return true
+}
+
+// TrainingQuota counts the training runs of the client and the model against the daily quota. Runs which failed to
+// start, e.g. because the container does not exist, are given back.
+func TrainingQuota() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client, modelId := clientOf(c), modelOf(c)
+		if ok, wait := helper.GetRateLimiter().AllowTraining(client, modelId); !ok {
+			tooManyRequests(c, wait, "the daily training quota is used up")
+			return
+		}
+		c.Next()
+		if c.Writer.Status() >= http.StatusBadRequest {
+			helper.GetRateLimiter().RefundTraining(client, modelId)
+		}
+	}
+}
+
+// GetRateLimits godoc
+// @Tags admin
+// @Summary get rate limits
+// @Description returns the default rate limits and those of single models
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.RateLimitConfig
+// @Router /admin/limits [get]
+func GetRateLimits(c *gin.Context) {
+	c.JSON(http.StatusOK, helper.GetRateLimiter().Config())
+}
+
+// SetDefaultRateLimits godoc
+// @Tags admin
+// @Summary set default rate limits
+// @Description replaces the rate limits of all models without limits of their own, zero values turn a limit off
+// @Param data body helper.RateLimits true "limits"
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.RateLimitConfig
+// @Router /admin/limits [put]
+func SetDefaultRateLimits(c *gin.Context) {
+	limits, err := readRateLimits(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	helper.GetRateLimiter().SetDefault(limits)
+	c.JSON(http.StatusOK, helper.GetRateLimiter().Config())
+}
+
+// SetModelRateLimits godoc
+// @Tags admin
+// @Summary set model rate limits
+// @Description replaces the rate limits of a model, zero values turn a limit off
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param data body helper.RateLimits true "limits"
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.RateLimitConfig
+// @Router /admin/limits/models/{modelId} [put]
+func SetModelRateLimits(c *gin.Context) {
+	limits, err := readRateLimits(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	helper.GetRateLimiter().SetModelLimits(c.Param("modelId"), limits)
+	c.JSON(http.StatusOK, helper.GetRateLimiter().Config())
+}
+
+// RemoveModelRateLimits godoc
+// @Tags admin
+// @Summary remove model rate limits
+// @Description makes a model use the default rate limits again
+// @Param        modelId   path      string  true  "unique id for models"
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.RateLimitConfig
+// @Router /admin/limits/models/{modelId} [delete]
+func RemoveModelRateLimits(c *gin.Context) {
+	helper.GetRateLimiter().RemoveModelLimits(c.Param("modelId"))
+	c.JSON(http.StatusOK, helper.GetRateLimiter().Config())
+}
+
+// GetRateLimitUsage godoc
+// @Tags admin
+// @Summary get rate limit usage
+// @Description returns the remaining tokens and the training runs of today per client and model
+// @Accept json
+// @Produce json
+// @Success 200 {array} helper.ClientUsage
+// @Router /admin/limits/usage [get]
+func GetRateLimitUsage(c *gin.Context) {
+	c.JSON(http.StatusOK, helper.GetRateLimiter().Usage())
+}
+
+// ResetRateLimitUsage godoc
+// @Tags admin
+// @Summary reset rate limit usage
+// @Description refills the token buckets and clears the training runs of a client
+// @Param        client   path      string  true  "client id or ip address"
+// @Accept json
+// @Produce json
+// @Success 200 {string} message
+// @Router /admin/limits/usage/{client} [delete]
+func ResetRateLimitUsage(c *gin.Context) {
+	helper.GetRateLimiter().ResetClient(c.Param("client"))
+	c.JSON(http.StatusOK, "usage was reset")
+}
+
+func readRateLimits(c *gin.Context) (helper.RateLimits, error) {
+	var limits helper.RateLimits
+	decoder := json.NewDecoder(c.Request.Body)
+	if err := decoder.Decode(&limits); err != nil {
+		return helper.RateLimits{}, err
+	}
+	if limits.PredictionsPerSecond < 0 || limits.PredictionBurst < 0 || limits.TrainingsPerDay < 0 {
+		return helper.RateLimits{}, errors.New("limits can not be negative")
+	}
+	return limits, nil
+}
@@ -0,0 +1,114 @@
+package groups
+
+import (
+	"companionAI/helper"
+	"companionAI/lifecycle"
+	"companionAI/utils"
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionHeader tells the client which version served a routed prediction.
+const versionHeader = "X-Model-Version"
+
+// mirrorPrediction sends a copy of a successful prediction to the shadow version of the request.
+func mirrorPrediction(request *predictionRequest, status int, answer []byte) {
+	if request.shadow == "" || status != http.StatusOK || answer == nil {
+		return
+	}
+	var sentence helper.SentenceBody
+	if err := json.Unmarshal(request.body, &sentence); err != nil {
+		return
+	}
+	lifecycle.MirrorPrediction(request.modelId, request.version, request.shadow, sentence.Sentence, answer)
+}
+
+// PredictModel godoc
+// @Tags routing
+// @Summary predict datapoint with routing
+// @Description generates a prediction with the version picked by the routing of the model, the newest version without routing. A share of the predictions is copied to the shadow version of the routing, whose answers are only compared.
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param data body helper.SentenceBody true "prediction sentence"
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 502 {object} helper.UpstreamError
+// @Failure 504 {object} helper.UpstreamError
+// @Router /model/{modelId}/predict [post]
+func PredictModel(c *gin.Context) {
+	modelId := c.Param("modelId")
+
+	version, shadow, err := lifecycle.RouteVersion(modelId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	c.Header(versionHeader, version)
+
+	predictVersion(c, modelId, version, shadow)
+}
+
+// SetRouting godoc
+// @Tags routing
+// @Summary set routing
+// @Description sets the weights of the versions of a model for routed predictions and the shadow version which gets a copy of a percentage of them
+// @Param        modelId   path      string  true  "unique id for models"
+// @Param data body helper.RoutingConfig true "e.g. {\"weights\": {\"v1\": 90, \"v2\": 10}, \"shadow\": {\"version\": \"v3\", \"percent\": 20}}"
+// @Accept json
+// @Produce json
+// @Success 200 {object} helper.RoutingConfig
+// @Router /model/{modelId}/routing [post]
+func SetRouting(c *gin.Context) {
+	modelId := c.Param("modelId")
+	dir, err := os.Getwd()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var routing helper.RoutingConfig
+	decoder := json.NewDecoder(c.Request.Body)
+	err = decoder.Decode(&routing)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = utils.SetRouting(dir, modelId, routing)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, routing)
+}
+
+// GetShadowReport godoc
+// @Tags routing
+// @Summary get shadow report
+// @Description compares the answers of the shadow versions of a model with the versions which served the predictions and lists the latest disagreements
+// @Param        modelId   path      string  true  "unique id for models"
+// @Accept json
+// @Produce json
+// @Success 200 {array} lifecycle.ShadowComparison
+// @Router /model/{modelId}/shadow [get]
+func GetShadowReport(c *gin.Context) {
+	c.JSON(http.StatusOK, lifecycle.ShadowReport(c.Param("modelId")))
+}
+
+// ResetShadowReport godoc
+// @Tags routing
+// @Summary reset shadow report
+// @Description drops the comparisons of the shadow versions of a model
+// @Param        modelId   path      string  true  "unique id for models"
+// @Accept json
+// @Produce json
+// @Success 200 {string} message
+// @Router /model/{modelId}/shadow [delete]
+func ResetShadowReport(c *gin.Context) {
+	lifecycle.ResetShadowReport(c.Param("modelId"))
+	c.JSON(http.StatusOK, "shadow report was reset")
+}
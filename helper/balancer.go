@@ -0,0 +1,58 @@
+package helper
+
+import (
+	"companionAI/dockerManager"
+	"sort"
+	"sync"
+)
+
+// Strategies for choosing between the replicas of a model version.
+const (
+	RoundRobin       = "round-robin"
+	LeastOutstanding = "least-outstanding"
+)
+
+var (
+	balancerLock sync.Mutex
+	nextReplica  = make(map[string]int)
+)
+
+// Replicas returns the tracked containers of the model version, ordered by their id.
+func Replicas(modelId string, version string) []string {
+	var ids []string
+	for id := range GetRegistry().ByVersion(modelId, version) {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// PickReplica chooses a ready container of the model version with the given strategy. Replicas which are still
+// starting or unhealthy are skipped, if no replica is ready the last return value is false.
+func PickReplica(modelId string, version string, strategy string) (string, dockerManager.ContainerInformation, bool) {
+	ready := GetRegistry().InState(modelId, version, dockerManager.StateReady)
+	if len(ready) == 0 {
+		return "", dockerManager.ContainerInformation{}, false
+	}
+
+	balancerLock.Lock()
+	key := modelId + "/" + version
+	offset := nextReplica[key]
+	nextReplica[key] = offset + 1
+	balancerLock.Unlock()
+
+	picked := ready[offset%len(ready)]
+	if strategy == LeastOutstanding {
+		// start the search at the round-robin position, so replicas with equal load still take turns
+		best, _ := GetRegistry().Get(picked)
+		for i := 1; i < len(ready); i++ {
+			id := ready[(offset+i)%len(ready)]
+			if information, ok := GetRegistry().Get(id); ok && information.InFlight < best.InFlight {
+				picked, best = id, information
+			}
+		}
+	}
+
+	information, ok := GetRegistry().Get(picked)
+	return picked, information, ok
+}
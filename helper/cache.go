@@ -0,0 +1,176 @@
+package helper
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the number of predictions kept by the cache unless configured otherwise.
+const DefaultCacheSize = 10000
+
+// CachedPrediction is the answer of a model server to a prediction request.
+type CachedPrediction struct {
+	Key         string    `json:"key"`
+	ModelId     string    `json:"modelId"`
+	Version     string    `json:"version"`
+	ContentType string    `json:"contentType"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type CacheStats struct {
+	Entries   int   `json:"entries"`
+	Capacity  int   `json:"capacity"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// PredictionCache keeps the latest predictions in memory and evicts the least recently used one when it is full. A
+// capacity of 0 disables the cache.
+type PredictionCache struct {
+	lock      sync.Mutex
+	capacity  int
+	order     *list.List
+	entries   map[string]*list.Element
+	hits      int64
+	misses    int64
+	evictions int64
+	// generations counts the invalidations per model, answers requested before an invalidation are not cached.
+	generations map[string]uint64
+}
+
+func NewPredictionCache(capacity int) *PredictionCache {
+	return &PredictionCache{
+		capacity:    capacity,
+		order:       list.New(),
+		entries:     make(map[string]*list.Element),
+		generations: make(map[string]uint64),
+	}
+}
+
+// CacheKey identifies a prediction by the model version and the request body.
+func CacheKey(modelId string, version string, body []byte) string {
+	hash := sha256.Sum256(body)
+	return modelId + "/" + version + "/" + hex.EncodeToString(hash[:])
+}
+
+func (p *PredictionCache) Enabled() bool {
+	return p.capacity > 0
+}
+
+// Get returns the cached prediction and counts the lookup as hit or miss.
+func (p *PredictionCache) Get(key string) (CachedPrediction, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	element, ok := p.entries[key]
+	if !ok {
+		p.misses++
+		return CachedPrediction{}, false
+	}
+	p.hits++
+	p.order.MoveToFront(element)
+	return element.Value.(CachedPrediction), true
+}
+
+// Generation returns the number of invalidations of the model. It has to be read before the prediction is requested
+// from the model server and passed to Put.
+func (p *PredictionCache) Generation(modelId string) uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.generations[modelId]
+}
+
+// Put caches the prediction unless the model was invalidated since generation was read, the answer may come from the
+// previously loaded model then.
+func (p *PredictionCache) Put(prediction CachedPrediction, generation uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.generations[prediction.ModelId] != generation {
+		return
+	}
+	p.putLocked(prediction)
+}
+
+func (p *PredictionCache) putLocked(prediction CachedPrediction) {
+	if p.capacity <= 0 {
+		return
+	}
+	if element, ok := p.entries[prediction.Key]; ok {
+		element.Value = prediction
+		p.order.MoveToFront(element)
+		return
+	}
+	p.entries[prediction.Key] = p.order.PushFront(prediction)
+	for p.order.Len() > p.capacity {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		delete(p.entries, oldest.Value.(CachedPrediction).Key)
+		p.evictions++
+	}
+}
+
+// InvalidateModel removes the predictions of all versions of the model and returns how many were removed.
+func (p *PredictionCache) InvalidateModel(modelId string) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.generations[modelId]++
+	removed := 0
+	for element := p.order.Front(); element != nil; {
+		next := element.Next()
+		prediction := element.Value.(CachedPrediction)
+		if prediction.ModelId == modelId {
+			p.order.Remove(element)
+			delete(p.entries, prediction.Key)
+			removed++
+		}
+		element = next
+	}
+	return removed
+}
+
+// Clear removes all predictions, the counters are kept.
+func (p *PredictionCache) Clear() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.order.Init()
+	p.entries = make(map[string]*list.Element)
+}
+
+func (p *PredictionCache) Stats() CacheStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return CacheStats{
+		Entries:   p.order.Len(),
+		Capacity:  p.capacity,
+		Hits:      p.hits,
+		Misses:    p.misses,
+		Evictions: p.evictions,
+	}
+}
+
+// Entries returns the cached predictions, the least recently used first.
+func (p *PredictionCache) Entries() []CachedPrediction {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	predictions := make([]CachedPrediction, 0, p.order.Len())
+	for element := p.order.Back(); element != nil; element = element.Prev() {
+		predictions = append(predictions, element.Value.(CachedPrediction))
+	}
+	return predictions
+}
+
+// Restore puts the predictions into the cache in the order returned by Entries.
+func (p *PredictionCache) Restore(predictions []CachedPrediction) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, prediction := range predictions {
+		p.putLocked(prediction)
+	}
+}
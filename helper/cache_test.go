@@ -0,0 +1,165 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+// applyCacheOperations runs operations like "put m1/a" and "get m1/a" on the cache. "request m1/a" reads the
+// generation of the model like a request to the model server does, the following "put m1/a" uses it.
+func applyCacheOperations(cache *PredictionCache, operations []string) {
+	requested := make(map[string]uint64)
+	for _, operation := range operations {
+		fields := strings.Fields(operation)
+		switch fields[0] {
+		case "request":
+			requested[fields[1]] = cache.Generation(modelOfKey(fields[1]))
+		case "put":
+			modelId := modelOfKey(fields[1])
+			generation, ok := requested[fields[1]]
+			if !ok {
+				generation = cache.Generation(modelId)
+			}
+			cache.Put(CachedPrediction{Key: fields[1], ModelId: modelId, Body: []byte(fields[1])}, generation)
+		case "get":
+			cache.Get(fields[1])
+		case "invalidate":
+			cache.InvalidateModel(fields[1])
+		case "clear":
+			cache.Clear()
+		}
+	}
+}
+
+func modelOfKey(key string) string {
+	return strings.SplitN(key, "/", 2)[0]
+}
+
+func cachedKeys(cache *PredictionCache) []string {
+	var keys []string
+	for _, prediction := range cache.Entries() {
+		keys = append(keys, prediction.Key)
+	}
+	return keys
+}
+
+func TestPredictionCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		capacity   int
+		operations []string
+		// want are the cached keys, the least recently used first
+		want      []string
+		wantStats CacheStats
+	}{
+		{
+			name:       "keeps insertion order",
+			capacity:   3,
+			operations: []string{"put m1/a", "put m1/b", "put m1/c"},
+			want:       []string{"m1/a", "m1/b", "m1/c"},
+			wantStats:  CacheStats{Entries: 3, Capacity: 3},
+		},
+		{
+			name:       "evicts the least recently used",
+			capacity:   2,
+			operations: []string{"put m1/a", "put m1/b", "put m1/c"},
+			want:       []string{"m1/b", "m1/c"},
+			wantStats:  CacheStats{Entries: 2, Capacity: 2, Evictions: 1},
+		},
+		{
+			name:       "get marks as recently used",
+			capacity:   2,
+			operations: []string{"put m1/a", "put m1/b", "get m1/a", "put m1/c"},
+			want:       []string{"m1/a", "m1/c"},
+			wantStats:  CacheStats{Entries: 2, Capacity: 2, Hits: 1, Evictions: 1},
+		},
+		{
+			name:       "put replaces without eviction",
+			capacity:   2,
+			operations: []string{"put m1/a", "put m1/b", "put m1/a"},
+			want:       []string{"m1/b", "m1/a"},
+			wantStats:  CacheStats{Entries: 2, Capacity: 2},
+		},
+		{
+			name:       "counts misses",
+			capacity:   2,
+			operations: []string{"get m1/a", "put m1/a", "get m1/a", "get m1/b"},
+			want:       []string{"m1/a"},
+			wantStats:  CacheStats{Entries: 1, Capacity: 2, Hits: 1, Misses: 2},
+		},
+		{
+			name:       "invalidates a model",
+			capacity:   3,
+			operations: []string{"put m1/a", "put m2/a", "put m1/b", "invalidate m1"},
+			want:       []string{"m2/a"},
+			wantStats:  CacheStats{Entries: 1, Capacity: 3},
+		},
+		{
+			name:       "answer requested before an invalidation",
+			capacity:   3,
+			operations: []string{"request m1/a", "invalidate m1", "put m1/a"},
+			wantStats:  CacheStats{Capacity: 3},
+		},
+		{
+			name:       "answer requested after an invalidation",
+			capacity:   3,
+			operations: []string{"invalidate m1", "request m1/a", "put m1/a"},
+			want:       []string{"m1/a"},
+			wantStats:  CacheStats{Entries: 1, Capacity: 3},
+		},
+		{
+			name:       "invalidation of another model",
+			capacity:   3,
+			operations: []string{"request m2/a", "invalidate m1", "put m2/a"},
+			want:       []string{"m2/a"},
+			wantStats:  CacheStats{Entries: 1, Capacity: 3},
+		},
+		{
+			name:       "clear keeps the counters",
+			capacity:   2,
+			operations: []string{"put m1/a", "get m1/a", "clear"},
+			wantStats:  CacheStats{Capacity: 2, Hits: 1},
+		},
+		{
+			name:       "disabled",
+			capacity:   0,
+			operations: []string{"put m1/a", "get m1/a"},
+			wantStats:  CacheStats{Misses: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewPredictionCache(test.capacity)
+			applyCacheOperations(cache, test.operations)
+
+			if got := cachedKeys(cache); strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("Entries() = %v, want %v", got, test.want)
+			}
+			if got := cache.Stats(); got != test.wantStats {
+				t.Errorf("Stats() = %+v, want %+v", got, test.wantStats)
+			}
+		})
+	}
+}
+
+func TestPredictionCacheRestore(t *testing.T) {
+	cache := NewPredictionCache(3)
+	applyCacheOperations(cache, []string{"put m1/a", "put m1/b", "get m1/a"})
+
+	restored := NewPredictionCache(2)
+	restored.Restore(cache.Entries())
+	if got := cachedKeys(restored); strings.Join(got, ",") != "m1/b,m1/a" {
+		t.Errorf("Entries() after Restore = %v, want [m1/b m1/a]", got)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	key := CacheKey("m1", "v1", []byte(`{"sentence":"a"}`))
+	if key != CacheKey("m1", "v1", []byte(`{"sentence":"a"}`)) {
+		t.Error("CacheKey() differs for the same request")
+	}
+	if key == CacheKey("m1", "v2", []byte(`{"sentence":"a"}`)) || key == CacheKey("m1", "v1", []byte(`{"sentence":"b"}`)) {
+		t.Error("CacheKey() is the same for different requests")
+	}
+}
@@ -1,13 +1,108 @@
 package helper
 
-import "companionAI/dockerManager"
+import (
+	"companionAI/dockerManager"
+	"sync"
+)
 
-var containerTracker = make(map[string]dockerManager.ContainerInformation)
+var containerRegistry = NewContainerRegistry()
 
-func GetContainerTracker() map[string]dockerManager.ContainerInformation {
-	return containerTracker
+// maxCrashRecords is the number of crashes kept per model.
+const maxCrashRecords = 20
+
+var (
+	crashLock    sync.Mutex
+	crashHistory = make(map[string][]CrashRecord)
+)
+
+// hostDir is the folder on the docker host which is mounted to mnt, set by main from the first argument.
+var hostDir string
+
+// containerRuntime is set by main before the server starts.
+var containerRuntime dockerManager.Runtime
+
+var portAllocator = NewPortAllocator(DefaultMinPort, DefaultMaxPort)
+
+var predictionCache = NewPredictionCache(DefaultCacheSize)
+
+// rateLimiter has no limits until main configures them.
+var rateLimiter = NewRateLimiter(RateLimits{})
+
+// trustClientId lets clients name themselves for the rate limits, only behind a proxy which sets the header.
+var trustClientId bool
+
+// GetRegistry returns the registry of the containers started by the server.
+func GetRegistry() *ContainerRegistry {
+	return containerRegistry
+}
+
+func RecordCrash(modelId string, crash CrashRecord) {
+	crashLock.Lock()
+	defer crashLock.Unlock()
+	crashes := append(crashHistory[modelId], crash)
+	if len(crashes) > maxCrashRecords {
+		crashes = crashes[len(crashes)-maxCrashRecords:]
+	}
+	crashHistory[modelId] = crashes
+}
+
+// GetCrashes returns the latest crashes of the model containers, the oldest first.
+func GetCrashes(modelId string) []CrashRecord {
+	crashLock.Lock()
+	defer crashLock.Unlock()
+	return append([]CrashRecord(nil), crashHistory[modelId]...)
+}
+
+func GetRuntime() dockerManager.Runtime {
+	return containerRuntime
+}
+
+// SetRuntime replaces the runtime used by the handlers, e.g. with a dockerManager.FakeRuntime.
+func SetRuntime(runtime dockerManager.Runtime) {
+	containerRuntime = runtime
+}
+
+func GetPortAllocator() *PortAllocator {
+	return portAllocator
+}
+
+// SetPortAllocator replaces the allocator of the host ports, e.g. to use another port range.
+func SetPortAllocator(allocator *PortAllocator) {
+	portAllocator = allocator
+}
+
+func GetPredictionCache() *PredictionCache {
+	return predictionCache
+}
+
+// SetPredictionCache replaces the cache of the predictions, e.g. with one of another size.
+func SetPredictionCache(cache *PredictionCache) {
+	predictionCache = cache
+}
+
+func GetRateLimiter() *RateLimiter {
+	return rateLimiter
+}
+
+// SetRateLimiter replaces the limiter of the predictions and training runs, e.g. with other default limits.
+func SetRateLimiter(limiter *RateLimiter) {
+	rateLimiter = limiter
+}
+
+// TrustsClientId tells whether the rate limits are kept per X-Client-Id header instead of per ip address.
+func TrustsClientId() bool {
+	return trustClientId
+}
+
+func SetTrustClientId(trust bool) {
+	trustClientId = trust
+}
+
+// GetHostDir returns the host folder of mnt, it is empty if the server was started without it.
+func GetHostDir() string {
+	return hostDir
 }
 
-func ResetContainerTracker() {
-	containerTracker = make(map[string]dockerManager.ContainerInformation)
+func SetHostDir(dir string) {
+	hostDir = dir
 }
@@ -1,5 +1,10 @@
 package helper
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type ModelTypes struct {
 	ModelTypes []ModelType `json:"modelTypes"`
 }
@@ -16,6 +21,10 @@ type LabelBody struct {
 	Labels []string `json:"labels"`
 }
 
+type ScaleBody struct {
+	Replicas int `json:"replicas"`
+}
+
 type SentenceBody struct {
 	Sentence string `json:"sentence"`
 }
@@ -31,9 +40,87 @@ type NewModel struct {
 }
 
 type ModelInformation struct {
-	Type          string   `json:"model-type"`
-	NewestVersion string   `json:"newest-version"`
-	Labels        []string `json:"labels"`
+	Type          string         `json:"model-type"`
+	NewestVersion string         `json:"newest-version"`
+	Labels        []string       `json:"labels"`
+	IdleTimeout   string         `json:"idle-timeout,omitempty"`
+	Replicas      map[string]int `json:"replicas,omitempty"`
+	LoadBalancing string         `json:"load-balancing,omitempty"`
+	Resources     *Resources     `json:"resources,omitempty"`
+	RestartPolicy *RestartPolicy `json:"restart-policy,omitempty"`
+	Crashes       []CrashRecord  `json:"crashes,omitempty"`
+}
+
+// RestartPolicy decides how often a crashed container of a model is restarted. The wait before a restart starts at
+// Backoff and doubles with every restart of the same container.
+type RestartPolicy struct {
+	MaxRestarts int    `json:"max-restarts"`
+	Backoff     string `json:"backoff,omitempty"`
+}
+
+type CrashRecord struct {
+	ContainerId string    `json:"containerId"`
+	Version     string    `json:"version"`
+	Time        time.Time `json:"time"`
+	ExitCode    int       `json:"exitCode"`
+	OutOfMemory bool      `json:"outOfMemory"`
+	Restarted   bool      `json:"restarted"`
+}
+
+// Resources limit every container of a model. Training runs inside the serving container, so they apply to both.
+type Resources struct {
+	Cpus      float64 `json:"cpus,omitempty"`
+	Memory    string  `json:"memory,omitempty"`
+	PidsLimit int64   `json:"pids-limit,omitempty"`
+}
+
+// CaptureConfig turns on the capture of the predictions of a model. The capture file is rotated once it grows larger
+// than MaxFileSize bytes, MaxFiles files are kept including the current one.
+type CaptureConfig struct {
+	Enabled     bool  `json:"enabled"`
+	MaxFileSize int64 `json:"max-file-size,omitempty"`
+	MaxFiles    int   `json:"max-files,omitempty"`
+}
+
+// CapturedPrediction is a prediction request together with the answer of the model server.
+type CapturedPrediction struct {
+	Id          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	ModelId     string    `json:"modelId"`
+	Version     string    `json:"version"`
+	ContainerId string    `json:"containerId,omitempty"`
+	// Cached is true if the prediction was answered from the prediction cache.
+	Cached    bool            `json:"cached,omitempty"`
+	LatencyMs float64         `json:"latencyMs"`
+	Status    int             `json:"status"`
+	Request   json.RawMessage `json:"request"`
+	Response  json.RawMessage `json:"response,omitempty"`
+}
+
+type CapturePage struct {
+	Total    int                  `json:"total"`
+	Offset   int                  `json:"offset"`
+	Limit    int                  `json:"limit"`
+	Captures []CapturedPrediction `json:"captures"`
+}
+
+type PromoteBody struct {
+	Ids []string `json:"ids"`
+	// Entities replaces the predicted entities of a capture by its id, e.g. after it was re-labelled.
+	Entities map[string][]EntityInformation `json:"entities,omitempty"`
+}
+
+// RoutingConfig splits the predictions of a model between its versions. Weights maps the versions to their share of the
+// traffic, without weights the newest version gets all of it. The shadow version additionally receives a copy of
+// Percent of the predictions, its answers are compared but never returned.
+type RoutingConfig struct {
+	Weights map[string]int `json:"weights,omitempty"`
+	Shadow  *ShadowRoute   `json:"shadow,omitempty"`
+}
+
+type ShadowRoute struct {
+	Version string  `json:"version"`
+	Percent float64 `json:"percent"`
 }
 
 type EntityDataPoints struct {
@@ -52,8 +139,26 @@ type EntityInformation struct {
 	EntityLabel      string `json:"label"`
 }
 
+type LogLine struct {
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+}
+
 type ContainerInfo struct {
-	Id   string `json:"id"`
-	Ip   string `json:"ip"`
-	Port string `json:"port"`
+	Id      string `json:"id"`
+	Ip      string `json:"ip"`
+	Address string `json:"address"`
+	Port    string `json:"port"`
+	State   string `json:"state"`
+}
+
+// UpstreamError is returned instead of the response of a model container which could not be reached.
+type UpstreamError struct {
+	Error       string `json:"error"`
+	ContainerId string `json:"containerId"`
+	Url         string `json:"url"`
+}
+
+type BatchBody struct {
+	Sentences []string `json:"sentences"`
 }
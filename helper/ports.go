@@ -0,0 +1,99 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default range of host ports the model containers are bound to, the dynamic ports of IANA.
+const (
+	DefaultMinPort = 49152
+	DefaultMaxPort = 65535
+)
+
+var ErrNoFreePort = errors.New("no free port left in range")
+
+// PortAllocator hands out host ports for new containers. A reserved port is held until Release is called, which
+// should happen as soon as the container is registered: from then on the registry holds the port until the container
+// is stopped and removed.
+type PortAllocator struct {
+	min, max int
+
+	mu       sync.Mutex
+	next     int
+	reserved map[string]bool
+}
+
+func NewPortAllocator(min int, max int) *PortAllocator {
+	return &PortAllocator{min: min, max: max, next: min, reserved: make(map[string]bool)}
+}
+
+// ParsePortRange parses a range like 49152-65535.
+func ParsePortRange(portRange string) (int, int, error) {
+	parts := strings.Split(portRange, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid port range %q, expected min-max", portRange)
+	}
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", portRange, err)
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q: %w", portRange, err)
+	}
+	if min < 1 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("invalid port range %q", portRange)
+	}
+	return min, max, nil
+}
+
+// Reserve returns a port which is neither reserved, held by a tracked container nor in use on the host. Ports are
+// handed out in turns, so a port released a moment ago is not reused right away.
+func (p *PortAllocator) Reserve() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tracked := make(map[string]bool)
+	for _, container := range GetRegistry().All() {
+		tracked[container.Port] = true
+	}
+
+	size := p.max - p.min + 1
+	for i := 0; i < size; i++ {
+		candidate := p.next
+		p.next++
+		if p.next > p.max {
+			p.next = p.min
+		}
+
+		port := strconv.Itoa(candidate)
+		if p.reserved[port] || tracked[port] || !portFree(port) {
+			continue
+		}
+		p.reserved[port] = true
+		return port, nil
+	}
+	return "", fmt.Errorf("%w %d-%d", ErrNoFreePort, p.min, p.max)
+}
+
+// Release gives a reserved port back. Releasing a port which is not reserved does nothing.
+func (p *PortAllocator) Release(port string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.reserved, port)
+}
+
+// portFree checks whether the port can be bound on the host right now.
+func portFree(port string) bool {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
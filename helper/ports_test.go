@@ -0,0 +1,106 @@
+package helper
+
+import (
+	"companionAI/dockerManager"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		portRange string
+		wantMin   int
+		wantMax   int
+		wantErr   bool
+	}{
+		{portRange: "49152-65535", wantMin: 49152, wantMax: 65535},
+		{portRange: " 8000 - 8000 ", wantMin: 8000, wantMax: 8000},
+		{portRange: "8000", wantErr: true},
+		{portRange: "8000-7000", wantErr: true},
+		{portRange: "0-100", wantErr: true},
+		{portRange: "8000-70000", wantErr: true},
+		{portRange: "a-b", wantErr: true},
+		{portRange: "1-2-3", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.portRange, func(t *testing.T) {
+			min, max, err := ParsePortRange(test.portRange)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParsePortRange() error = %v, want error %v", err, test.wantErr)
+			}
+			if min != test.wantMin || max != test.wantMax {
+				t.Errorf("ParsePortRange() = %d, %d, want %d, %d", min, max, test.wantMin, test.wantMax)
+			}
+		})
+	}
+}
+
+// reserveAll reserves n ports and fails the test on errors.
+func reserveAll(t *testing.T, allocator *PortAllocator, n int) []string {
+	t.Helper()
+	var ports []string
+	for i := 0; i < n; i++ {
+		port, err := allocator.Reserve()
+		if err != nil {
+			t.Fatalf("Reserve() error = %v", err)
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name string
+		// tracked is a port held by a container in the registry
+		tracked string
+		// listening is a port which is in use on the host
+		listening string
+		reserve   int
+		want      []string
+	}{
+		{name: "in turns", reserve: 3, want: []string{"61210", "61211", "61212"}},
+		{name: "skips tracked ports", tracked: "61211", reserve: 2, want: []string{"61210", "61212"}},
+		{name: "skips ports in use", listening: "61210", reserve: 2, want: []string{"61211", "61212"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.tracked != "" {
+				GetRegistry().Register("ports-test", dockerManager.ContainerInformation{Port: test.tracked})
+				defer GetRegistry().Remove("ports-test")
+			}
+			if test.listening != "" {
+				listener, err := net.Listen("tcp", ":"+test.listening)
+				if err != nil {
+					t.Skipf("port %s is not available: %v", test.listening, err)
+				}
+				defer listener.Close()
+			}
+
+			got := reserveAll(t, NewPortAllocator(61210, 61212), test.reserve)
+			for i := range test.want {
+				if got[i] != test.want[i] {
+					t.Fatalf("Reserve() = %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReserveExhausted(t *testing.T) {
+	allocator := NewPortAllocator(61220, 61221)
+	ports := reserveAll(t, allocator, 2)
+
+	if _, err := allocator.Reserve(); !errors.Is(err, ErrNoFreePort) {
+		t.Fatalf("Reserve() error = %v, want %v", err, ErrNoFreePort)
+	}
+
+	allocator.Release(ports[0])
+	port, err := allocator.Reserve()
+	if err != nil || port != ports[0] {
+		t.Errorf("Reserve() = %s, %v, want the released port %s", port, err, ports[0])
+	}
+}
@@ -0,0 +1,265 @@
+package helper
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimits apply to every client of a model. Zero values turn the limit off.
+type RateLimits struct {
+	// PredictionsPerSecond refills the token bucket of a client.
+	PredictionsPerSecond float64 `json:"predictionsPerSecond"`
+	// PredictionBurst is the size of the token bucket, it is at least 1.
+	PredictionBurst int `json:"predictionBurst"`
+	// TrainingsPerDay is the number of training runs a client can start per model and UTC day.
+	TrainingsPerDay int `json:"trainingsPerDay"`
+}
+
+type RateLimitConfig struct {
+	Default RateLimits `json:"default"`
+	// Models overrides the default limits per model.
+	Models map[string]RateLimits `json:"models"`
+}
+
+// ClientUsage is what a client used of the limits of a model.
+type ClientUsage struct {
+	Client         string  `json:"client"`
+	ModelId        string  `json:"modelId"`
+	Tokens         float64 `json:"tokens"`
+	TrainingsToday int     `json:"trainingsToday"`
+}
+
+type clientKey struct {
+	client  string
+	modelId string
+}
+
+type clientBucket struct {
+	tokens    float64
+	updated   time.Time
+	trainings int
+	// day is the UTC day the trainings were counted on.
+	day string
+}
+
+// RateLimiter keeps a token bucket for the predictions and a counter for the training runs of every client and model.
+type RateLimiter struct {
+	lock       sync.Mutex
+	config     RateLimitConfig
+	buckets    map[clientKey]*clientBucket
+	lastPruned time.Time
+}
+
+// ParseRateLimits parses limits like predictions=20,burst=40,trainings=10, missing limits are off.
+func ParseRateLimits(value string) (RateLimits, error) {
+	var limits RateLimits
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return limits, fmt.Errorf("invalid rate limit %q", entry)
+		}
+		var err error
+		switch parts[0] {
+		case "predictions":
+			limits.PredictionsPerSecond, err = strconv.ParseFloat(parts[1], 64)
+		case "burst":
+			limits.PredictionBurst, err = strconv.Atoi(parts[1])
+		case "trainings":
+			limits.TrainingsPerDay, err = strconv.Atoi(parts[1])
+		default:
+			return limits, fmt.Errorf("invalid rate limit %q", entry)
+		}
+		if err != nil {
+			return limits, fmt.Errorf("invalid rate limit %q: %w", entry, err)
+		}
+	}
+	if limits.PredictionsPerSecond < 0 || limits.PredictionBurst < 0 || limits.TrainingsPerDay < 0 {
+		return limits, fmt.Errorf("invalid rate limits %q, limits can not be negative", value)
+	}
+	return limits, nil
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		config:  RateLimitConfig{Default: limits, Models: make(map[string]RateLimits)},
+		buckets: make(map[clientKey]*clientBucket),
+	}
+}
+
+func (r *RateLimiter) limitsLocked(modelId string) RateLimits {
+	if limits, ok := r.config.Models[modelId]; ok {
+		return limits
+	}
+	return r.config.Default
+}
+
+func burst(limits RateLimits) float64 {
+	if limits.PredictionBurst < 1 {
+		return 1
+	}
+	return float64(limits.PredictionBurst)
+}
+
+// bucketLocked returns the bucket of the client refilled up to now.
+func (r *RateLimiter) bucketLocked(client string, modelId string, now time.Time) *clientBucket {
+	limits := r.limitsLocked(modelId)
+	key := clientKey{client: client, modelId: modelId}
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = &clientBucket{tokens: burst(limits), updated: now}
+		r.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(burst(limits), bucket.tokens+now.Sub(bucket.updated).Seconds()*limits.PredictionsPerSecond)
+	bucket.updated = now
+	if day := now.UTC().Format("2006-01-02"); bucket.day != day {
+		bucket.day = day
+		bucket.trainings = 0
+	}
+	return bucket
+}
+
+// AllowPrediction takes cost tokens from the bucket of the client, one per sentence. A cost above the size of the
+// bucket needs a full bucket and leaves it in debt. If there are not enough tokens, it returns how long the client
+// has to wait for them.
+func (r *RateLimiter) AllowPrediction(client string, modelId string, cost int) (bool, time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	limits := r.limitsLocked(modelId)
+	if limits.PredictionsPerSecond <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	r.pruneLocked(now)
+	bucket := r.bucketLocked(client, modelId, now)
+	needed := math.Min(float64(cost), burst(limits))
+	if bucket.tokens < needed {
+		wait := (needed - bucket.tokens) / limits.PredictionsPerSecond
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	bucket.tokens -= float64(cost)
+	return true, 0
+}
+
+// AllowTraining counts a training run of the client. If the quota of the day is used up, it returns the time until the
+// next UTC day.
+func (r *RateLimiter) AllowTraining(client string, modelId string) (bool, time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	limits := r.limitsLocked(modelId)
+	if limits.TrainingsPerDay <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	r.pruneLocked(now)
+	bucket := r.bucketLocked(client, modelId, now)
+	if bucket.trainings >= limits.TrainingsPerDay {
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return false, tomorrow.Sub(now)
+	}
+	bucket.trainings++
+	return true, 0
+}
+
+// RefundTraining gives back a training run counted by AllowTraining which did not start. Runs counted on a previous
+// UTC day are not given back, the quota of today starts over anyway.
+func (r *RateLimiter) RefundTraining(client string, modelId string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.limitsLocked(modelId).TrainingsPerDay <= 0 {
+		return
+	}
+	bucket := r.bucketLocked(client, modelId, time.Now())
+	if bucket.trainings > 0 {
+		bucket.trainings--
+	}
+}
+
+// pruneLocked drops the buckets which are full again and have no training runs today, at most once a minute.
+func (r *RateLimiter) pruneLocked(now time.Time) {
+	if now.Sub(r.lastPruned) < time.Minute {
+		return
+	}
+	r.lastPruned = now
+	today := now.UTC().Format("2006-01-02")
+	for key, bucket := range r.buckets {
+		limits := r.limitsLocked(key.modelId)
+		full := limits.PredictionsPerSecond <= 0 ||
+			bucket.tokens+now.Sub(bucket.updated).Seconds()*limits.PredictionsPerSecond >= burst(limits)
+		if full && (bucket.day != today || bucket.trainings == 0) {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+func (r *RateLimiter) Config() RateLimitConfig {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	config := RateLimitConfig{Default: r.config.Default, Models: make(map[string]RateLimits, len(r.config.Models))}
+	for modelId, limits := range r.config.Models {
+		config.Models[modelId] = limits
+	}
+	return config
+}
+
+// SetDefault replaces the limits of the models without limits of their own. Buckets keep their tokens.
+func (r *RateLimiter) SetDefault(limits RateLimits) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.config.Default = limits
+}
+
+func (r *RateLimiter) SetModelLimits(modelId string, limits RateLimits) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.config.Models[modelId] = limits
+}
+
+// RemoveModelLimits makes the model use the default limits again.
+func (r *RateLimiter) RemoveModelLimits(modelId string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.config.Models, modelId)
+}
+
+// Usage returns the state of the buckets which are in use, sorted by client and model.
+func (r *RateLimiter) Usage() []ClientUsage {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	usage := make([]ClientUsage, 0, len(r.buckets))
+	for key := range r.buckets {
+		bucket := r.bucketLocked(key.client, key.modelId, now)
+		usage = append(usage, ClientUsage{Client: key.client, ModelId: key.modelId, Tokens: bucket.tokens, TrainingsToday: bucket.trainings})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Client != usage[j].Client {
+			return usage[i].Client < usage[j].Client
+		}
+		return usage[i].ModelId < usage[j].ModelId
+	})
+	return usage
+}
+
+// ResetClient refills the buckets and clears the training runs of the client for all models.
+func (r *RateLimiter) ResetClient(client string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for key := range r.buckets {
+		if key.client == client {
+			delete(r.buckets, key)
+		}
+	}
+}
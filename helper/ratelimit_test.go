@@ -0,0 +1,205 @@
+package helper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RateLimits
+		wantErr bool
+	}{
+		{value: "predictions=20,burst=40,trainings=10", want: RateLimits{PredictionsPerSecond: 20, PredictionBurst: 40, TrainingsPerDay: 10}},
+		{value: "predictions=0.5", want: RateLimits{PredictionsPerSecond: 0.5}},
+		{value: " trainings=3 ", want: RateLimits{TrainingsPerDay: 3}},
+		{value: "predictions", wantErr: true},
+		{value: "requests=5", wantErr: true},
+		{value: "burst=many", wantErr: true},
+		{value: "predictions=-1", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseRateLimits(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseRateLimits() error = %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && got != test.want {
+				t.Errorf("ParseRateLimits() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAllowPrediction(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits RateLimits
+		costs  []int
+		want   []bool
+	}{
+		{name: "no limits", limits: RateLimits{}, costs: []int{1, 100, 1}, want: []bool{true, true, true}},
+		{name: "burst", limits: RateLimits{PredictionsPerSecond: 1, PredictionBurst: 2}, costs: []int{1, 1, 1}, want: []bool{true, true, false}},
+		{name: "burst of at least one", limits: RateLimits{PredictionsPerSecond: 1}, costs: []int{1, 1}, want: []bool{true, false}},
+		{name: "cost per sentence", limits: RateLimits{PredictionsPerSecond: 1, PredictionBurst: 5}, costs: []int{3, 3, 2}, want: []bool{true, false, true}},
+		{name: "cost above burst needs a full bucket", limits: RateLimits{PredictionsPerSecond: 1, PredictionBurst: 5}, costs: []int{8, 1}, want: []bool{true, false}},
+		{name: "cost above burst after a prediction", limits: RateLimits{PredictionsPerSecond: 1, PredictionBurst: 5}, costs: []int{1, 8}, want: []bool{true, false}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewRateLimiter(test.limits)
+			for i, cost := range test.costs {
+				ok, wait := limiter.AllowPrediction("client", "m1", cost)
+				if ok != test.want[i] {
+					t.Fatalf("AllowPrediction() of cost %d number %d = %v, want %v", cost, i, ok, test.want[i])
+				}
+				if !ok && wait <= 0 {
+					t.Errorf("AllowPrediction() denied without a wait time")
+				}
+			}
+		})
+	}
+}
+
+func TestAllowPredictionRefill(t *testing.T) {
+	tests := []struct {
+		name string
+		// spent is taken from the full bucket of 2 tokens before the time elapses
+		spent   int
+		elapsed time.Duration
+		costs   []int
+		want    []bool
+	}{
+		{name: "not refilled yet", spent: 2, elapsed: 500 * time.Millisecond, costs: []int{1}, want: []bool{false}},
+		{name: "one token", spent: 2, elapsed: time.Second, costs: []int{1, 1}, want: []bool{true, false}},
+		{name: "two tokens", spent: 2, elapsed: 2 * time.Second, costs: []int{2}, want: []bool{true}},
+		{name: "not above burst", spent: 2, elapsed: time.Minute, costs: []int{2, 1}, want: []bool{true, false}},
+		{name: "debt is paid back first", spent: 4, elapsed: 2 * time.Second, costs: []int{1}, want: []bool{false}},
+		{name: "debt paid back", spent: 4, elapsed: 3 * time.Second, costs: []int{1}, want: []bool{true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewRateLimiter(RateLimits{PredictionsPerSecond: 1, PredictionBurst: 2})
+			if ok, _ := limiter.AllowPrediction("client", "m1", test.spent); !ok {
+				t.Fatal("AllowPrediction() denied a full bucket")
+			}
+
+			bucket := limiter.buckets[clientKey{client: "client", modelId: "m1"}]
+			bucket.updated = bucket.updated.Add(-test.elapsed)
+
+			for i, cost := range test.costs {
+				if ok, _ := limiter.AllowPrediction("client", "m1", cost); ok != test.want[i] {
+					t.Errorf("AllowPrediction() of cost %d after %s = %v, want %v", cost, test.elapsed, ok, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAllowPredictionPerClientAndModel(t *testing.T) {
+	limiter := NewRateLimiter(RateLimits{PredictionsPerSecond: 1, PredictionBurst: 1})
+	limiter.SetModelLimits("m2", RateLimits{})
+
+	requests := []struct {
+		client  string
+		modelId string
+		want    bool
+	}{
+		{client: "a", modelId: "m1", want: true},
+		{client: "a", modelId: "m1", want: false},
+		{client: "b", modelId: "m1", want: true},
+		{client: "a", modelId: "m3", want: true},
+		{client: "a", modelId: "m2", want: true},
+		{client: "a", modelId: "m2", want: true},
+	}
+	for _, request := range requests {
+		if ok, _ := limiter.AllowPrediction(request.client, request.modelId, 1); ok != request.want {
+			t.Errorf("AllowPrediction(%s, %s) = %v, want %v", request.client, request.modelId, ok, request.want)
+		}
+	}
+
+	limiter.ResetClient("a")
+	if ok, _ := limiter.AllowPrediction("a", "m1", 1); !ok {
+		t.Error("AllowPrediction() denied after ResetClient")
+	}
+}
+
+func TestAllowTraining(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits RateLimits
+		// yesterday moves the trainings counted so far to the day before
+		yesterday bool
+		runs      int
+		want      bool
+	}{
+		{name: "no quota", limits: RateLimits{}, runs: 10, want: true},
+		{name: "within quota", limits: RateLimits{TrainingsPerDay: 2}, runs: 1, want: true},
+		{name: "quota used up", limits: RateLimits{TrainingsPerDay: 2}, runs: 2, want: false},
+		{name: "new day", limits: RateLimits{TrainingsPerDay: 2}, runs: 2, yesterday: true, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewRateLimiter(test.limits)
+			for i := 0; i < test.runs; i++ {
+				if ok, _ := limiter.AllowTraining("client", "m1"); !ok {
+					t.Fatalf("AllowTraining() number %d denied", i)
+				}
+			}
+			if bucket, ok := limiter.buckets[clientKey{client: "client", modelId: "m1"}]; ok && test.yesterday {
+				bucket.day = time.Now().UTC().Add(-24 * time.Hour).Format("2006-01-02")
+			}
+
+			ok, wait := limiter.AllowTraining("client", "m1")
+			if ok != test.want {
+				t.Fatalf("AllowTraining() = %v, want %v", ok, test.want)
+			}
+			if !ok && (wait <= 0 || wait > 24*time.Hour) {
+				t.Errorf("AllowTraining() wait = %s, want the time until the next UTC day", wait)
+			}
+		})
+	}
+}
+
+func TestRefundTraining(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits RateLimits
+		// runs are counted before the refund
+		runs int
+		// yesterday moves the trainings counted so far to the day before
+		yesterday bool
+		want      int
+	}{
+		{name: "refunded", limits: RateLimits{TrainingsPerDay: 2}, runs: 2, want: 1},
+		{name: "nothing to refund", limits: RateLimits{TrainingsPerDay: 2}, want: 0},
+		{name: "counted yesterday", limits: RateLimits{TrainingsPerDay: 2}, runs: 2, yesterday: true, want: 0},
+		{name: "no quota", limits: RateLimits{}, runs: 2, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewRateLimiter(test.limits)
+			for i := 0; i < test.runs; i++ {
+				limiter.AllowTraining("client", "m1")
+			}
+			if bucket, ok := limiter.buckets[clientKey{client: "client", modelId: "m1"}]; ok && test.yesterday {
+				bucket.day = time.Now().UTC().Add(-24 * time.Hour).Format("2006-01-02")
+			}
+
+			limiter.RefundTraining("client", "m1")
+			got := 0
+			if bucket, ok := limiter.buckets[clientKey{client: "client", modelId: "m1"}]; ok {
+				got = bucket.trainings
+			}
+			if got != test.want {
+				t.Errorf("got %d training runs after RefundTraining(), want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package helper
+
+import (
+	"companionAI/dockerManager"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotRegistered     = errors.New("container is not registered")
+	ErrInvalidTransition = errors.New("invalid state transition")
+)
+
+// transitions lists the states a container can move to from each state. Stopped is final, the container is removed
+// from the registry afterwards. Failed containers can only be stopped.
+var transitions = map[string][]string{
+	dockerManager.StateBuilding:  {dockerManager.StateStarting, dockerManager.StateStopping, dockerManager.StateFailed},
+	dockerManager.StateStarting:  {dockerManager.StateReady, dockerManager.StateUnhealthy, dockerManager.StateExited, dockerManager.StateStopping, dockerManager.StateStopped, dockerManager.StateFailed},
+	dockerManager.StateReady:     {dockerManager.StateUnhealthy, dockerManager.StateExited, dockerManager.StateStopping, dockerManager.StateStopped},
+	dockerManager.StateUnhealthy: {dockerManager.StateStarting, dockerManager.StateReady, dockerManager.StateExited, dockerManager.StateStopping, dockerManager.StateStopped, dockerManager.StateFailed},
+	dockerManager.StateExited:    {dockerManager.StateStarting, dockerManager.StateStopping, dockerManager.StateStopped, dockerManager.StateFailed},
+	dockerManager.StateStopping:  {dockerManager.StateStopped, dockerManager.StateFailed},
+	dockerManager.StateStopped:   {},
+	dockerManager.StateFailed:    {dockerManager.StateStopping},
+}
+
+// ContainerChange is sent to the subscribers of the registry whenever a container is registered, changes its state
+// or is removed.
+type ContainerChange struct {
+	ContainerId string `json:"containerId"`
+	// PreviousState is empty for newly registered containers.
+	PreviousState string                             `json:"previousState"`
+	Information   dockerManager.ContainerInformation `json:"information"`
+	Removed       bool                               `json:"removed"`
+}
+
+// ContainerRegistry keeps the containers started by the server together with their lifecycle state. All methods are
+// safe for concurrent use, the getters return copies.
+type ContainerRegistry struct {
+	mu          sync.RWMutex
+	containers  map[string]dockerManager.ContainerInformation
+	subscribers map[chan ContainerChange]struct{}
+}
+
+func NewContainerRegistry() *ContainerRegistry {
+	return &ContainerRegistry{
+		containers:  make(map[string]dockerManager.ContainerInformation),
+		subscribers: make(map[chan ContainerChange]struct{}),
+	}
+}
+
+// Register adds a container in state building or starting, other states are replaced by starting. Containers whose
+// image is still building have no id yet, they are registered under a placeholder until Started.
+func (r *ContainerRegistry) Register(containerId string, information dockerManager.ContainerInformation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if information.State != dockerManager.StateBuilding {
+		information.State = dockerManager.StateStarting
+	}
+	r.containers[containerId] = information
+	r.publish(ContainerChange{ContainerId: containerId, Information: information})
+}
+
+// Started replaces the placeholder of a build by the container started from the image, which moves into state
+// starting. It fails if the placeholder was removed or stopped in the meantime.
+func (r *ContainerRegistry) Started(buildId string, containerId string, information dockerManager.ContainerInformation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	build, ok := r.containers[buildId]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRegistered, buildId)
+	}
+	if !allowedTransition(build.State, dockerManager.StateStarting) {
+		return fmt.Errorf("%w of container %s from %s to %s", ErrInvalidTransition, buildId, build.State, dockerManager.StateStarting)
+	}
+
+	delete(r.containers, buildId)
+	information.State = dockerManager.StateStarting
+	r.containers[containerId] = information
+	r.publish(ContainerChange{ContainerId: containerId, PreviousState: build.State, Information: information})
+	return nil
+}
+
+// Remove drops a container from the registry. It returns false if the container was not registered.
+func (r *ContainerRegistry) Remove(containerId string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	information, ok := r.containers[containerId]
+	if !ok {
+		return false
+	}
+	delete(r.containers, containerId)
+	r.publish(ContainerChange{ContainerId: containerId, PreviousState: information.State, Information: information, Removed: true})
+	return true
+}
+
+// Transition moves a container into state. Moving into the current state does nothing, transitions which are not
+// allowed return ErrInvalidTransition.
+func (r *ContainerRegistry) Transition(containerId string, state string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	information, ok := r.containers[containerId]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRegistered, containerId)
+	}
+	if information.State == state {
+		return nil
+	}
+	if !allowedTransition(information.State, state) {
+		return fmt.Errorf("%w of container %s from %s to %s", ErrInvalidTransition, containerId, information.State, state)
+	}
+
+	previous := information.State
+	information.State = state
+	r.containers[containerId] = information
+	r.publish(ContainerChange{ContainerId: containerId, PreviousState: previous, Information: information})
+	return nil
+}
+
+func allowedTransition(from string, to string) bool {
+	for _, state := range transitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Update applies update to a registered container and returns false if it is not registered. The state can only be
+// changed with Transition, changes of it are discarded.
+func (r *ContainerRegistry) Update(containerId string, update func(information *dockerManager.ContainerInformation)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	information, ok := r.containers[containerId]
+	if !ok {
+		return false
+	}
+	state := information.State
+	update(&information)
+	information.State = state
+	r.containers[containerId] = information
+	return true
+}
+
+// BeginRequest marks a request to the container as in flight, it has to be finished with EndRequest.
+func (r *ContainerRegistry) BeginRequest(containerId string) {
+	r.Update(containerId, func(information *dockerManager.ContainerInformation) {
+		information.InFlight++
+		information.LastRequest = time.Now()
+	})
+}
+
+func (r *ContainerRegistry) EndRequest(containerId string) {
+	r.Update(containerId, func(information *dockerManager.ContainerInformation) {
+		information.InFlight--
+		information.LastRequest = time.Now()
+	})
+}
+
+func (r *ContainerRegistry) Get(containerId string) (dockerManager.ContainerInformation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	information, ok := r.containers[containerId]
+	return information, ok
+}
+
+// All returns every registered container.
+func (r *ContainerRegistry) All() map[string]dockerManager.ContainerInformation {
+	return r.filter(func(dockerManager.ContainerInformation) bool { return true })
+}
+
+// ByModel returns the containers of all versions of the model.
+func (r *ContainerRegistry) ByModel(modelId string) map[string]dockerManager.ContainerInformation {
+	return r.filter(func(information dockerManager.ContainerInformation) bool {
+		return information.ModelId == modelId
+	})
+}
+
+// ByVersion returns the containers of the model version.
+func (r *ContainerRegistry) ByVersion(modelId string, version string) map[string]dockerManager.ContainerInformation {
+	return r.filter(func(information dockerManager.ContainerInformation) bool {
+		return information.ModelId == modelId && information.Version == version
+	})
+}
+
+// InState returns the ids of the containers of the model version in the given state, ordered by id.
+func (r *ContainerRegistry) InState(modelId string, version string, state string) []string {
+	var ids []string
+	for id, information := range r.ByVersion(modelId, version) {
+		if information.State == state {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (r *ContainerRegistry) filter(keep func(information dockerManager.ContainerInformation) bool) map[string]dockerManager.ContainerInformation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	containers := make(map[string]dockerManager.ContainerInformation)
+	for id, information := range r.containers {
+		if keep(information) {
+			containers[id] = information
+		}
+	}
+	return containers
+}
+
+// Subscribe returns a channel receiving the changes of the registry. Request counters are not reported. Subscribers
+// which do not keep up miss changes instead of blocking the registry, unsubscribe closes the channel.
+func (r *ContainerRegistry) Subscribe() (changes <-chan ContainerChange, unsubscribe func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	channel := make(chan ContainerChange, 64)
+	r.subscribers[channel] = struct{}{}
+	return channel, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, ok := r.subscribers[channel]; ok {
+			delete(r.subscribers, channel)
+			close(channel)
+		}
+	}
+}
+
+// publish has to be called with the lock held.
+func (r *ContainerRegistry) publish(change ContainerChange) {
+	for subscriber := range r.subscribers {
+		select {
+		case subscriber <- change:
+		default:
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package helper
+
+import (
+	"companionAI/dockerManager"
+	"errors"
+	"testing"
+)
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		name string
+		// path is the states the container moves through after it was registered in state starting
+		path    []string
+		want    string
+		wantErr error
+	}{
+		{name: "ready", path: []string{dockerManager.StateReady}, want: dockerManager.StateReady},
+		{name: "same state", path: []string{dockerManager.StateStarting}, want: dockerManager.StateStarting},
+		{name: "unhealthy recovers", path: []string{dockerManager.StateReady, dockerManager.StateUnhealthy, dockerManager.StateReady}, want: dockerManager.StateReady},
+		{name: "restarted after crash", path: []string{dockerManager.StateReady, dockerManager.StateExited, dockerManager.StateStarting}, want: dockerManager.StateStarting},
+		{name: "stopped", path: []string{dockerManager.StateReady, dockerManager.StateStopping, dockerManager.StateStopped}, want: dockerManager.StateStopped},
+		{name: "ready again after exit", path: []string{dockerManager.StateExited, dockerManager.StateReady}, want: dockerManager.StateExited, wantErr: ErrInvalidTransition},
+		{name: "stopped is final", path: []string{dockerManager.StateStopped, dockerManager.StateStarting}, want: dockerManager.StateStopped, wantErr: ErrInvalidTransition},
+		{name: "failed can only be stopped", path: []string{dockerManager.StateFailed, dockerManager.StateReady}, want: dockerManager.StateFailed, wantErr: ErrInvalidTransition},
+		{name: "stopping can not be ready", path: []string{dockerManager.StateStopping, dockerManager.StateReady}, want: dockerManager.StateStopping, wantErr: ErrInvalidTransition},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := NewContainerRegistry()
+			registry.Register("c1", dockerManager.ContainerInformation{ModelId: "m1", Version: "v1"})
+
+			var err error
+			for _, state := range test.path {
+				if err = registry.Transition("c1", state); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Transition() error = %v, want %v", err, test.wantErr)
+			}
+			information, _ := registry.Get("c1")
+			if information.State != test.want {
+				t.Errorf("state = %s, want %s", information.State, test.want)
+			}
+		})
+	}
+}
+
+func TestTransitionNotRegistered(t *testing.T) {
+	registry := NewContainerRegistry()
+	if err := registry.Transition("c1", dockerManager.StateReady); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("Transition() error = %v, want %v", err, ErrNotRegistered)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		state string
+		want  string
+	}{
+		{state: "", want: dockerManager.StateStarting},
+		{state: dockerManager.StateReady, want: dockerManager.StateStarting},
+		{state: dockerManager.StateBuilding, want: dockerManager.StateBuilding},
+	}
+
+	for _, test := range tests {
+		t.Run(test.state, func(t *testing.T) {
+			registry := NewContainerRegistry()
+			registry.Register("c1", dockerManager.ContainerInformation{State: test.state})
+			if information, _ := registry.Get("c1"); information.State != test.want {
+				t.Errorf("state = %s, want %s", information.State, test.want)
+			}
+		})
+	}
+}
+
+func TestStarted(t *testing.T) {
+	tests := []struct {
+		name string
+		// path is the states the placeholder moves through after it was registered in state building
+		path       []string
+		registered bool
+		wantErr    error
+	}{
+		{name: "started", registered: true},
+		{name: "stopped while building", path: []string{dockerManager.StateStopping}, registered: true, wantErr: ErrInvalidTransition},
+		{name: "build failed", path: []string{dockerManager.StateFailed}, registered: true, wantErr: ErrInvalidTransition},
+		{name: "removed while building", wantErr: ErrNotRegistered},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := NewContainerRegistry()
+			if test.registered {
+				registry.Register("building-1", dockerManager.ContainerInformation{ModelId: "m1", Version: "v1", State: dockerManager.StateBuilding})
+			}
+			for _, state := range test.path {
+				if err := registry.Transition("building-1", state); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := registry.Started("building-1", "c1", dockerManager.ContainerInformation{ModelId: "m1", Version: "v1"})
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Started() error = %v, want %v", err, test.wantErr)
+			}
+			information, tracked := registry.Get("c1")
+			if tracked != (test.wantErr == nil) {
+				t.Fatalf("container is tracked %v, want %v", tracked, test.wantErr == nil)
+			}
+			if tracked && information.State != dockerManager.StateStarting {
+				t.Errorf("state = %s, want %s", information.State, dockerManager.StateStarting)
+			}
+			if _, tracked := registry.Get("building-1"); tracked && test.wantErr == nil {
+				t.Error("placeholder is still tracked after Started()")
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsState(t *testing.T) {
+	registry := NewContainerRegistry()
+	registry.Register("c1", dockerManager.ContainerInformation{})
+	registry.Update("c1", func(information *dockerManager.ContainerInformation) {
+		information.State = dockerManager.StateReady
+		information.Restarts = 2
+	})
+	information, _ := registry.Get("c1")
+	if information.State != dockerManager.StateStarting || information.Restarts != 2 {
+		t.Errorf("got state %s and %d restarts, want %s and 2", information.State, information.Restarts, dockerManager.StateStarting)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	registry := NewContainerRegistry()
+	changes, unsubscribe := registry.Subscribe()
+
+	registry.Register("c1", dockerManager.ContainerInformation{})
+	_ = registry.Transition("c1", dockerManager.StateReady)
+	registry.BeginRequest("c1")
+	registry.Remove("c1")
+	unsubscribe()
+
+	want := []ContainerChange{
+		{ContainerId: "c1", PreviousState: "", Information: dockerManager.ContainerInformation{State: dockerManager.StateStarting}},
+		{ContainerId: "c1", PreviousState: dockerManager.StateStarting, Information: dockerManager.ContainerInformation{State: dockerManager.StateReady}},
+		{ContainerId: "c1", PreviousState: dockerManager.StateReady, Removed: true},
+	}
+	var got []ContainerChange
+	for change := range changes {
+		got = append(got, change)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].ContainerId != want[i].ContainerId || got[i].PreviousState != want[i].PreviousState || got[i].Removed != want[i].Removed {
+			t.Errorf("change %d = %+v, want %+v", i, got[i], want[i])
+		}
+		if !want[i].Removed && got[i].Information.State != want[i].Information.State {
+			t.Errorf("change %d has state %s, want %s", i, got[i].Information.State, want[i].Information.State)
+		}
+	}
+}
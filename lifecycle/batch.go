@@ -0,0 +1,137 @@
+package lifecycle
+
+import (
+	"bytes"
+	"companionAI/helper"
+	"companionAI/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxBatchConcurrency caps the number of predictions of a batch running at the same time.
+const MaxBatchConcurrency = 64
+
+var predictClient = &http.Client{Timeout: 2 * time.Minute}
+
+// BatchResult is the prediction of one sentence of a batch. Either Prediction or Error is set.
+type BatchResult struct {
+	Index       int             `json:"index"`
+	ContainerId string          `json:"containerId,omitempty"`
+	Prediction  json.RawMessage `json:"prediction,omitempty"`
+	// Status is the status code of the model server, it is 0 if the server could not be reached.
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// PredictBatch predicts the sentences with the ready containers of the model version, with at most concurrency
+// predictions at the same time. A container is started if none is ready. The results are passed to emit in the order
+// of the sentences, as soon as all sentences before them are done. Failed predictions do not stop the batch.
+func PredictBatch(ctx context.Context, modelId string, version string, sentences []string, concurrency int, emit func(result BatchResult)) error {
+	if concurrency < 1 || concurrency > MaxBatchConcurrency {
+		return fmt.Errorf("concurrency has to be between 1 and %d", MaxBatchConcurrency)
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	config, err := utils.LoadConfig(dir, modelId)
+	if err != nil {
+		return err
+	}
+
+	// make sure there is a ready container before the fan out
+	if _, _, err := EnsureReady(ctx, modelId, version, DefaultReadinessOptions); err != nil {
+		return err
+	}
+
+	indices := make(chan int)
+	go func() {
+		defer close(indices)
+		for i := range sentences {
+			select {
+			case indices <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		lock    sync.Mutex
+		results = make([]*BatchResult, len(sentences))
+		next    = 0
+	)
+	var workers sync.WaitGroup
+	for w := 0; w < concurrency && w < len(sentences); w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range indices {
+				result := predictSentence(ctx, modelId, version, config.LoadBalancing, sentences[i])
+				result.Index = i
+
+				lock.Lock()
+				results[i] = &result
+				for next < len(results) && results[next] != nil {
+					emit(*results[next])
+					results[next] = nil
+					next++
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	workers.Wait()
+	return ctx.Err()
+}
+
+func predictSentence(ctx context.Context, modelId string, version string, strategy string, sentence string) BatchResult {
+	containerId, information, ok := helper.PickReplica(modelId, version, strategy)
+	if !ok {
+		// the container went away during the batch
+		var err error
+		containerId, information, err = EnsureReady(ctx, modelId, version, DefaultReadinessOptions)
+		if err != nil {
+			return BatchResult{Error: err.Error()}
+		}
+	}
+
+	helper.GetRegistry().BeginRequest(containerId)
+	defer helper.GetRegistry().EndRequest(containerId)
+
+	body, err := json.Marshal(helper.SentenceBody{Sentence: sentence})
+	if err != nil {
+		return BatchResult{ContainerId: containerId, Error: err.Error()}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, helper.ContainerUrl(information, "/predict"), bytes.NewReader(body))
+	if err != nil {
+		return BatchResult{ContainerId: containerId, Error: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := predictClient.Do(req)
+	if err != nil {
+		return BatchResult{ContainerId: containerId, Error: err.Error()}
+	}
+	defer res.Body.Close()
+
+	answer, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return BatchResult{ContainerId: containerId, Status: res.StatusCode, Error: err.Error()}
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return BatchResult{ContainerId: containerId, Status: res.StatusCode, Error: strings.TrimSpace(string(answer))}
+	}
+	if !json.Valid(answer) {
+		answer, _ = json.Marshal(string(answer))
+	}
+	return BatchResult{ContainerId: containerId, Status: res.StatusCode, Prediction: answer}
+}
@@ -0,0 +1,279 @@
+package lifecycle
+
+import (
+	"bytes"
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// States of a build job.
+const (
+	BuildRunning   = "running"
+	BuildSucceeded = "succeeded"
+	BuildFailed    = "failed"
+	BuildCancelled = "cancelled"
+)
+
+// finishedBuildRetention is how long finished builds can still be looked up.
+const finishedBuildRetention = time.Hour
+
+type BuildInfo struct {
+	Id      string `json:"id"`
+	ModelId string `json:"modelId"`
+	Image   string `json:"image"`
+	// Cached builds did not run, because the image of the same build context already existed.
+	Cached     bool       `json:"cached"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// BuildJob is an image build running in the background. The output of the build is kept line by line, so it can
+// be streamed to clients which subscribe while the build is still running.
+type BuildJob struct {
+	mu          sync.Mutex
+	info        BuildInfo
+	lines       []string
+	partial     []byte
+	subscribers map[chan string]struct{}
+	cancel      context.CancelFunc
+	done        chan struct{}
+	err         error
+}
+
+var (
+	buildsLock sync.Mutex
+	builds     = make(map[string]*BuildJob)
+)
+
+// BuildModelImage builds the image of the model, tagged with the hash of its build context. If the image of an
+// unchanged context already exists, a finished cached build is returned instead.
+func BuildModelImage(ctx context.Context, modelId string) (*BuildJob, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	buildContextPath := dir + "/mnt/models/" + modelId
+	hash, err := dockerManager.ContextHash(buildContextPath)
+	if err != nil {
+		return nil, err
+	}
+	image := imageTag(modelId, hash)
+
+	exists, err := helper.GetRuntime().ImageExists(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return cachedBuild(modelId, image), nil
+	}
+	return StartBuild(modelId, image, buildContextPath), nil
+}
+
+// StartBuild builds the image in the background. If the same image is already being built, that build is returned
+// instead of starting another one.
+func StartBuild(modelId string, image string, buildContextPath string) *BuildJob {
+	buildsLock.Lock()
+	defer buildsLock.Unlock()
+
+	pruneBuilds()
+	for _, job := range builds {
+		info := job.Info()
+		if info.Status == BuildRunning && info.Image == image {
+			return job
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &BuildJob{
+		info:        BuildInfo{Id: newId(), ModelId: modelId, Image: image, Status: BuildRunning, StartedAt: time.Now()},
+		subscribers: make(map[chan string]struct{}),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	builds[job.info.Id] = job
+
+	go func() {
+		err := helper.GetRuntime().Build(ctx, buildContextPath, []string{image}, dockerManager.ImageLabels(modelId), job)
+		job.finish(ctx, err)
+	}()
+	return job
+}
+
+// imageTag names the image of a model after the hash of its build context.
+func imageTag(modelId string, hash string) string {
+	return modelId + ":" + hash[:16]
+}
+
+func cachedBuild(modelId string, image string) *BuildJob {
+	buildsLock.Lock()
+	defer buildsLock.Unlock()
+
+	pruneBuilds()
+	now := time.Now()
+	job := &BuildJob{
+		info:        BuildInfo{Id: newId(), ModelId: modelId, Image: image, Cached: true, Status: BuildSucceeded, StartedAt: now, FinishedAt: &now},
+		lines:       []string{"image " + image + " is up to date"},
+		subscribers: make(map[chan string]struct{}),
+		cancel:      func() {},
+		done:        make(chan struct{}),
+	}
+	close(job.done)
+	builds[job.info.Id] = job
+	return job
+}
+
+// pruneBuilds has to be called with the buildsLock held.
+func pruneBuilds() {
+	for id, job := range builds {
+		info := job.Info()
+		if info.FinishedAt != nil && time.Since(*info.FinishedAt) > finishedBuildRetention {
+			delete(builds, id)
+		}
+	}
+}
+
+func GetBuild(id string) (*BuildJob, bool) {
+	buildsLock.Lock()
+	defer buildsLock.Unlock()
+	job, ok := builds[id]
+	return job, ok
+}
+
+// GetBuilds returns all known builds, the newest first.
+func GetBuilds() []BuildInfo {
+	buildsLock.Lock()
+	defer buildsLock.Unlock()
+
+	infos := make([]BuildInfo, 0, len(builds))
+	for _, job := range builds {
+		infos = append(infos, job.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartedAt.After(infos[j].StartedAt)
+	})
+	return infos
+}
+
+func (b *BuildJob) Info() BuildInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.info
+}
+
+// Cancel aborts the build, the job finishes in state cancelled.
+func (b *BuildJob) Cancel() {
+	b.cancel()
+}
+
+// Wait blocks until the build finished and returns its error. Cancelling ctx only stops waiting, not the build.
+func (b *BuildJob) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.done:
+		return b.err
+	}
+}
+
+// Subscribe returns the lines logged so far and a channel receiving the following ones. The channel is closed when
+// the build finished, unsubscribe has to be called if the caller stops reading earlier.
+func (b *BuildJob) Subscribe() (lines []string, next <-chan string, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines = append(lines, b.lines...)
+	channel := make(chan string, 64)
+	if b.info.Status != BuildRunning {
+		close(channel)
+		return lines, channel, func() {}
+	}
+
+	b.subscribers[channel] = struct{}{}
+	return lines, channel, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[channel]; ok {
+			delete(b.subscribers, channel)
+			close(channel)
+		}
+	}
+}
+
+// Write splits the build output into lines and hands them to the subscribers.
+func (b *BuildJob) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.partial = append(b.partial, p...)
+	for {
+		index := bytes.IndexByte(b.partial, '\n')
+		if index < 0 {
+			break
+		}
+		b.publish(string(b.partial[:index]))
+		b.partial = b.partial[index+1:]
+	}
+	return len(p), nil
+}
+
+// publish has to be called with the lock held. Subscribers which do not keep up miss lines instead of blocking the
+// build.
+func (b *BuildJob) publish(line string) {
+	b.lines = append(b.lines, line)
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- line:
+		default:
+		}
+	}
+}
+
+func (b *BuildJob) finish(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.partial) > 0 {
+		b.publish(string(b.partial))
+		b.partial = nil
+	}
+
+	finishedAt := time.Now()
+	b.info.FinishedAt = &finishedAt
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		b.info.Status = BuildCancelled
+		err = errors.New("build was cancelled")
+	case err != nil:
+		b.info.Status = BuildFailed
+	default:
+		b.info.Status = BuildSucceeded
+	}
+	if err != nil {
+		b.info.Error = err.Error()
+	}
+	b.err = err
+
+	for subscriber := range b.subscribers {
+		close(subscriber)
+	}
+	b.subscribers = make(map[chan string]struct{})
+	b.cancel()
+	close(b.done)
+}
+
+func newId() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
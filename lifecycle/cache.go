@@ -0,0 +1,56 @@
+package lifecycle
+
+import (
+	"companionAI/helper"
+	"companionAI/utils"
+	"log"
+	"os"
+	"time"
+)
+
+// LoadPredictionCache fills the prediction cache with the predictions saved by PersistPredictionCache. Predictions of
+// versions which were trained again after the prediction was cached are dropped.
+func LoadPredictionCache() error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	predictions, err := utils.LoadPredictionCache(dir)
+	if err != nil {
+		return err
+	}
+
+	trainedAt := make(map[string]time.Time)
+	current := make([]helper.CachedPrediction, 0, len(predictions))
+	for _, prediction := range predictions {
+		key := prediction.ModelId + "/" + prediction.Version
+		trained, known := trainedAt[key]
+		if !known {
+			trained, err = utils.TrainedAt(dir, prediction.ModelId, prediction.Version)
+			if err != nil {
+				log.Printf("could not check the training of model %s %s: %v", prediction.ModelId, prediction.Version, err)
+				// without knowing when the version was trained, its predictions can not be trusted
+				trained = time.Now()
+			}
+			trainedAt[key] = trained
+		}
+		if trained.After(prediction.CreatedAt) {
+			continue
+		}
+		current = append(current, prediction)
+	}
+	helper.GetPredictionCache().Restore(current)
+	return nil
+}
+
+// PersistPredictionCache saves the cached predictions. Failures are only logged, the cache in memory stays valid.
+func PersistPredictionCache() {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Println("could not persist prediction cache:", err)
+		return
+	}
+	if err := utils.SavePredictionCache(dir, helper.GetPredictionCache().Entries()); err != nil {
+		log.Println("could not persist prediction cache:", err)
+	}
+}
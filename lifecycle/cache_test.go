@@ -0,0 +1,66 @@
+package lifecycle
+
+import (
+	"companionAI/helper"
+	"companionAI/utils"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadPredictionCache(t *testing.T) {
+	cachedAt := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		// trainedAt is when the version was trained, the zero time if it never was
+		trainedAt time.Time
+		wantKept  bool
+	}{
+		{name: "never trained", wantKept: true},
+		{name: "trained before the prediction", trainedAt: cachedAt.Add(-time.Hour), wantKept: true},
+		{name: "trained after the prediction", trainedAt: cachedAt.Add(time.Minute), wantKept: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupModel(t, &modelServer{loadStatus: http.StatusOK}, utils.Config{})
+			dir, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.trainedAt.IsZero() {
+				modelPath := dir + "/mnt/models/m1/model-v1"
+				if err := os.MkdirAll(modelPath, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(modelPath+"/meta.json", []byte("{}"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				for _, path := range []string{modelPath + "/meta.json", modelPath} {
+					if err := os.Chtimes(path, test.trainedAt, test.trainedAt); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			prediction := helper.CachedPrediction{Key: "m1/v1/a", ModelId: "m1", Version: "v1", Body: []byte("{}"), CreatedAt: cachedAt}
+			if err := utils.SavePredictionCache(dir, []helper.CachedPrediction{prediction}); err != nil {
+				t.Fatal(err)
+			}
+
+			cache := helper.NewPredictionCache(10)
+			previous := helper.GetPredictionCache()
+			helper.SetPredictionCache(cache)
+			t.Cleanup(func() { helper.SetPredictionCache(previous) })
+
+			if err := LoadPredictionCache(); err != nil {
+				t.Fatalf("LoadPredictionCache() error = %v", err)
+			}
+			if kept := len(cache.Entries()) == 1; kept != test.wantKept {
+				t.Errorf("prediction kept %v, want %v", kept, test.wantKept)
+			}
+		})
+	}
+}
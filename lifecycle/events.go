@@ -0,0 +1,166 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"companionAI/utils"
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultRestartBackoff is used for restart policies without a backoff.
+const defaultRestartBackoff = 5 * time.Second
+
+// stopEventWait is the time a die event waits for the stop event which follows it if the container was stopped
+// from outside of the server, only containers which were not stopped count as crashed.
+const stopEventWait = 2 * time.Second
+
+var (
+	oomLock   sync.Mutex
+	oomKilled = make(map[string]bool)
+)
+
+// WatchEvents follows the container events of the runtime in the background, until ctx is cancelled. Crashed
+// containers are restarted according to the restart policy of their model.
+func WatchEvents(ctx context.Context) {
+	go func() {
+		for {
+			err := helper.GetRuntime().Events(ctx, handleEvent)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("container event stream broke, reconnecting:", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+}
+
+func handleEvent(event dockerManager.ContainerEvent) {
+	information, tracked := helper.GetRegistry().Get(event.ContainerId)
+	if !tracked || information.State == dockerManager.StateStopping {
+		return
+	}
+
+	switch event.Action {
+	case dockerManager.EventOom:
+		// docker sends oom before die
+		oomLock.Lock()
+		oomKilled[event.ContainerId] = true
+		oomLock.Unlock()
+	case dockerManager.EventDie:
+		handleCrash(event, information)
+	case dockerManager.EventStop:
+		// stopped from outside of the server, e.g. with docker stop
+		log.Printf("container %s was stopped externally", event.ContainerId)
+		_ = helper.GetRegistry().Transition(event.ContainerId, dockerManager.StateStopped)
+		helper.GetRegistry().Remove(event.ContainerId)
+	}
+}
+
+func handleCrash(event dockerManager.ContainerEvent, information dockerManager.ContainerInformation) {
+	oomLock.Lock()
+	outOfMemory := oomKilled[event.ContainerId]
+	delete(oomKilled, event.ContainerId)
+	oomLock.Unlock()
+
+	registry := helper.GetRegistry()
+	if err := registry.Transition(event.ContainerId, dockerManager.StateExited); err != nil {
+		log.Println(err)
+		return
+	}
+
+	go func() {
+		time.Sleep(stopEventWait)
+		if current, tracked := registry.Get(event.ContainerId); !tracked || current.State != dockerManager.StateExited {
+			// stopped externally or taken care of in the meantime
+			return
+		}
+		recordCrash(event, information, outOfMemory)
+	}()
+}
+
+// recordCrash records the crash of a container which exited on its own and restarts it after the backoff of the
+// restart policy of its model, unless it crashed too often.
+func recordCrash(event dockerManager.ContainerEvent, information dockerManager.ContainerInformation, outOfMemory bool) {
+	registry := helper.GetRegistry()
+	crash := helper.CrashRecord{
+		ContainerId: event.ContainerId,
+		Version:     information.Version,
+		Time:        event.Time,
+		ExitCode:    event.ExitCode,
+		OutOfMemory: outOfMemory,
+	}
+
+	policy := restartPolicy(information.ModelId)
+	if information.Restarts >= policy.MaxRestarts {
+		log.Printf("container %s of model %s crashed with exit code %d, giving up after %d restarts", event.ContainerId, information.ModelId, event.ExitCode, information.Restarts)
+		helper.RecordCrash(information.ModelId, crash)
+		_ = registry.Transition(event.ContainerId, dockerManager.StateFailed)
+		registry.Remove(event.ContainerId)
+		return
+	}
+
+	crash.Restarted = true
+	helper.RecordCrash(information.ModelId, crash)
+
+	backoff := defaultRestartBackoff
+	if parsed, err := time.ParseDuration(policy.Backoff); err == nil {
+		backoff = parsed
+	}
+	backoff <<= information.Restarts
+	log.Printf("container %s of model %s crashed with exit code %d, restarting in %s", event.ContainerId, information.ModelId, event.ExitCode, backoff)
+
+	go func() {
+		time.Sleep(backoff)
+		restartContainer(event.ContainerId)
+	}()
+}
+
+func restartContainer(containerId string) {
+	registry := helper.GetRegistry()
+	information, tracked := registry.Get(containerId)
+	if !tracked || information.State != dockerManager.StateExited {
+		// stopped or taken care of in the meantime
+		return
+	}
+
+	ctx := context.Background()
+	if err := helper.GetRuntime().Restart(ctx, containerId); err != nil {
+		log.Printf("could not restart container %s: %v", containerId, err)
+		_ = registry.Transition(containerId, dockerManager.StateFailed)
+		registry.Remove(containerId)
+		return
+	}
+
+	registry.Update(containerId, func(information *dockerManager.ContainerInformation) {
+		information.Restarts++
+		information.InFlight = 0
+		information.LastRequest = time.Now()
+	})
+	// updates are not published to the subscribers of the registry
+	PersistContainers()
+
+	// the model server lost the loaded version with the crash
+	if err := WaitUntilLoaded(ctx, containerId, information, information.Version, DefaultReadinessOptions); err != nil {
+		log.Printf("could not load version into restarted container %s: %v", containerId, err)
+	}
+}
+
+func restartPolicy(modelId string) helper.RestartPolicy {
+	dir, err := os.Getwd()
+	if err != nil {
+		return helper.RestartPolicy{}
+	}
+	config, err := utils.LoadConfig(dir, modelId)
+	if err != nil || config.RestartPolicy == nil {
+		return helper.RestartPolicy{}
+	}
+	return *config.RestartPolicy
+}
@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"companionAI/utils"
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// eventually polls condition until it holds or the timeout expires.
+func eventually(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return condition()
+}
+
+// crashesSince returns the crashes of model m1 recorded after start.
+func crashesSince(start time.Time) []helper.CrashRecord {
+	var crashes []helper.CrashRecord
+	for _, crash := range helper.GetCrashes("m1") {
+		if !crash.Time.Before(start) {
+			crashes = append(crashes, crash)
+		}
+	}
+	return crashes
+}
+
+func TestWatchEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxRestarts int
+		// exit ends the container like the runtime would
+		exit        func(runtime *dockerManager.FakeRuntime, containerId string) error
+		wantTracked bool
+		wantCrashes []helper.CrashRecord
+		wantLoads   int32
+	}{
+		{
+			name:        "crash is restarted",
+			maxRestarts: 1,
+			exit: func(runtime *dockerManager.FakeRuntime, containerId string) error {
+				return runtime.Crash(containerId, false)
+			},
+			wantTracked: true,
+			wantCrashes: []helper.CrashRecord{{ExitCode: 1, Restarted: true}},
+			wantLoads:   2,
+		},
+		{
+			name:        "out of memory",
+			maxRestarts: 1,
+			exit: func(runtime *dockerManager.FakeRuntime, containerId string) error {
+				return runtime.Crash(containerId, true)
+			},
+			wantTracked: true,
+			wantCrashes: []helper.CrashRecord{{ExitCode: 137, OutOfMemory: true, Restarted: true}},
+			wantLoads:   2,
+		},
+		{
+			name:        "gives up after max restarts",
+			maxRestarts: 0,
+			exit: func(runtime *dockerManager.FakeRuntime, containerId string) error {
+				return runtime.Crash(containerId, false)
+			},
+			wantTracked: false,
+			wantCrashes: []helper.CrashRecord{{ExitCode: 1}},
+			wantLoads:   1,
+		},
+		{
+			name:        "external stop is no crash",
+			maxRestarts: 1,
+			exit: func(runtime *dockerManager.FakeRuntime, containerId string) error {
+				// dies before it stops, like with docker stop
+				return runtime.Stop(context.Background(), containerId)
+			},
+			wantTracked: false,
+			wantLoads:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &modelServer{loadStatus: http.StatusOK}
+			runtime := setupModel(t, server, utils.Config{RestartPolicy: &helper.RestartPolicy{MaxRestarts: test.maxRestarts, Backoff: "10ms"}})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			WatchEvents(ctx)
+			// the watcher has to subscribe to the events before the container exits
+			select {
+			case <-runtime.Subscribed():
+			case <-time.After(time.Second):
+				t.Fatal("WatchEvents() did not subscribe to the events")
+			}
+
+			id, _, err := EnsureReady(context.Background(), "m1", "v1", testReadiness)
+			if err != nil {
+				t.Fatalf("EnsureReady() error = %v", err)
+			}
+			start := time.Now()
+			if err := test.exit(runtime, id); err != nil {
+				t.Fatal(err)
+			}
+
+			settled := eventually(stopEventWait+2*time.Second, func() bool {
+				information, tracked := helper.GetRegistry().Get(id)
+				if test.wantTracked {
+					return tracked && information.State == dockerManager.StateReady && information.Restarts == 1 && atomic.LoadInt32(&server.loads) == test.wantLoads
+				}
+				return !tracked
+			})
+			if !settled {
+				information, tracked := helper.GetRegistry().Get(id)
+				t.Fatalf("container is tracked %v in state %s with %d restarts, want tracked %v", tracked, information.State, information.Restarts, test.wantTracked)
+			}
+			if len(test.wantCrashes) == 0 {
+				// a die would only be recorded as crash once the stop event had the chance to arrive
+				time.Sleep(stopEventWait + 100*time.Millisecond)
+			}
+
+			crashes := crashesSince(start)
+			if len(crashes) != len(test.wantCrashes) {
+				t.Fatalf("got crashes %+v, want %+v", crashes, test.wantCrashes)
+			}
+			for i, want := range test.wantCrashes {
+				got := crashes[i]
+				if got.ContainerId != id || got.ExitCode != want.ExitCode || got.OutOfMemory != want.OutOfMemory || got.Restarted != want.Restarted {
+					t.Errorf("crash %d = %+v, want %+v of container %s", i, got, want, id)
+				}
+			}
+			if got := atomic.LoadInt32(&server.loads); got != test.wantLoads {
+				t.Errorf("version was loaded %d times, want %d", got, test.wantLoads)
+			}
+		})
+	}
+}
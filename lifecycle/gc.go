@@ -0,0 +1,199 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reasons for collecting an image or container.
+const (
+	ReasonModelDeleted = "model deleted"
+	ReasonSuperseded   = "superseded build"
+	ReasonStopped      = "stopped container"
+)
+
+// GarbageItem is an image or container which was removed by the garbage collector, or would be in a dry run.
+type GarbageItem struct {
+	Id      string   `json:"id"`
+	ModelId string   `json:"modelId"`
+	Tags    []string `json:"tags,omitempty"`
+	Size    int64    `json:"size,omitempty"`
+	Reason  string   `json:"reason"`
+	// Error is set if the removal failed, the item is collected again by the next run.
+	Error string `json:"error,omitempty"`
+}
+
+type GarbageReport struct {
+	StartedAt  time.Time     `json:"startedAt"`
+	DryRun     bool          `json:"dryRun"`
+	Containers []GarbageItem `json:"containers"`
+	Images     []GarbageItem `json:"images"`
+	// ReclaimedBytes sums up the size of the removed images.
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+}
+
+var (
+	garbageLock       sync.Mutex
+	lastGarbageReport = GarbageReport{Containers: []GarbageItem{}, Images: []GarbageItem{}}
+)
+
+// StartGarbageCollector runs CollectGarbage every interval until ctx is cancelled.
+func StartGarbageCollector(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := CollectGarbage(ctx, false); err != nil {
+					log.Println("could not collect garbage:", err)
+				}
+			}
+		}
+	}()
+}
+
+// CollectGarbage removes the stopped containers which are not registered and the images of deleted models or of
+// build contexts which changed since. Images still used by a container are kept. With dryRun nothing is removed, the
+// report lists what would be.
+func CollectGarbage(ctx context.Context, dryRun bool) (GarbageReport, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return GarbageReport{}, err
+	}
+
+	models, err := currentImages(dir)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+
+	runtime := helper.GetRuntime()
+	containers, err := runtime.List(ctx)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+
+	report := GarbageReport{StartedAt: time.Now(), DryRun: dryRun, Containers: []GarbageItem{}, Images: []GarbageItem{}}
+	inUse := make(map[string]bool)
+	for _, container := range containers {
+		_, registered := helper.GetRegistry().Get(container.Id)
+		if container.Running || registered {
+			inUse[container.Image] = true
+			continue
+		}
+
+		modelId := container.Labels[dockerManager.LabelModelId]
+		item := GarbageItem{Id: container.Id, ModelId: modelId, Reason: ReasonStopped}
+		if _, exists := models[modelId]; !exists {
+			item.Reason = ReasonModelDeleted
+		}
+		if !dryRun {
+			if err := runtime.Remove(ctx, container.Id); err != nil {
+				item.Error = err.Error()
+				inUse[container.Image] = true
+			}
+		}
+		report.Containers = append(report.Containers, item)
+	}
+
+	images, err := runtime.Images(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for _, image := range images {
+		if imageInUse(image, inUse) {
+			continue
+		}
+
+		modelId := image.Labels[dockerManager.LabelModelId]
+		current, exists := models[modelId]
+		item := GarbageItem{Id: image.Id, ModelId: modelId, Tags: image.Tags, Size: image.Size}
+		switch {
+		case !exists:
+			item.Reason = ReasonModelDeleted
+		case current != "" && !hasTag(image, current):
+			item.Reason = ReasonSuperseded
+		default:
+			continue
+		}
+
+		if !dryRun {
+			if err := runtime.RemoveImage(ctx, image.Id); err != nil {
+				item.Error = err.Error()
+			}
+		}
+		if item.Error == "" {
+			report.ReclaimedBytes += image.Size
+		}
+		report.Images = append(report.Images, item)
+	}
+
+	if !dryRun {
+		garbageLock.Lock()
+		lastGarbageReport = report
+		garbageLock.Unlock()
+	}
+	return report, nil
+}
+
+// LastGarbageReport returns the report of the latest run of CollectGarbage which was not a dry run.
+func LastGarbageReport() GarbageReport {
+	garbageLock.Lock()
+	defer garbageLock.Unlock()
+	return lastGarbageReport
+}
+
+// currentImages returns the image tag of the current build context for every model. If the context can not be hashed,
+// the tag is empty and none of the images of the model count as superseded.
+func currentImages(dir string) (map[string]string, error) {
+	files, err := ioutil.ReadDir(dir + "/mnt/models")
+	if err != nil {
+		return nil, err
+	}
+
+	models := make(map[string]string)
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		hash, err := dockerManager.ContextHash(dir + "/mnt/models/" + file.Name())
+		if err != nil {
+			log.Printf("could not hash build context of model %s: %v", file.Name(), err)
+			models[file.Name()] = ""
+			continue
+		}
+		models[file.Name()] = imageTag(file.Name(), hash)
+	}
+	return models, nil
+}
+
+// imageInUse checks the image against the images of the containers, which are either given by id or by tag.
+func imageInUse(image dockerManager.ImageStatus, inUse map[string]bool) bool {
+	if inUse[image.Id] {
+		return true
+	}
+	for _, tag := range image.Tags {
+		if inUse[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTag(image dockerManager.ImageStatus, tag string) bool {
+	for _, existing := range image.Tags {
+		if existing == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,365 @@
+package lifecycle
+
+import (
+	"companionAI/utils"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// States of a prediction job.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// maxQueuedJobs is the number of jobs which can wait for a worker, further jobs are refused.
+const maxQueuedJobs = 1000
+
+var ErrJobQueueFull = errors.New("too many prediction jobs are queued")
+
+type JobInfo struct {
+	Id          string     `json:"id"`
+	ModelId     string     `json:"modelId"`
+	Version     string     `json:"version"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Concurrency int        `json:"concurrency"`
+	Total       int        `json:"total"`
+	Done        int        `json:"done"`
+	Failed      int        `json:"failed"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// JobPage is a slice of the results of a job, the results are ordered like the sentences of the job.
+type JobPage struct {
+	JobInfo
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"`
+	Results []BatchResult `json:"results"`
+}
+
+// PredictionJob predicts a batch of sentences in the background. Jobs wait in a queue until one of the workers
+// started by StartJobWorkers picks them up.
+type PredictionJob struct {
+	mu              sync.Mutex
+	info            JobInfo
+	sentences       []string
+	results         []BatchResult
+	cancelRequested bool
+	cancel          context.CancelFunc
+	done            chan struct{}
+}
+
+// jobRecord is the saved form of a job.
+type jobRecord struct {
+	Info      JobInfo       `json:"info"`
+	Sentences []string      `json:"sentences"`
+	Results   []BatchResult `json:"results"`
+}
+
+var (
+	jobsLock     sync.Mutex
+	jobs         = make(map[string]*PredictionJob)
+	jobQueue     = make(chan *PredictionJob, maxQueuedJobs)
+	jobRetention = 24 * time.Hour
+)
+
+// StartJobWorkers loads the saved jobs and starts workers which run the queued jobs, until ctx is cancelled. Jobs
+// which were queued or running when the server stopped are queued again. Finished jobs are deleted after retention.
+func StartJobWorkers(ctx context.Context, workers int, retention time.Duration) error {
+	jobsLock.Lock()
+	jobRetention = retention
+	jobsLock.Unlock()
+
+	if err := loadJobs(); err != nil {
+		return err
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-jobQueue:
+					job.run(ctx)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				jobsLock.Lock()
+				pruneJobs()
+				jobsLock.Unlock()
+			}
+		}
+	}()
+	return nil
+}
+
+func loadJobs() error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	var records []jobRecord
+	err = utils.LoadJobs(dir, func(path string) error {
+		var record jobRecord
+		if err := utils.Load(path, &record); err != nil {
+			log.Printf("could not load prediction job %s: %v", path, err)
+			return nil
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Info.CreatedAt.Before(records[j].Info.CreatedAt)
+	})
+
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	for _, record := range records {
+		job := &PredictionJob{info: record.Info, sentences: record.Sentences, results: record.Results, done: make(chan struct{})}
+		jobs[job.info.Id] = job
+		if job.info.Status != JobQueued && job.info.Status != JobRunning {
+			close(job.done)
+			continue
+		}
+
+		// interrupted by the restart, the job starts over
+		job.info.Status = JobQueued
+		job.info.Done, job.info.Failed, job.info.StartedAt = 0, 0, nil
+		job.results = nil
+		select {
+		case jobQueue <- job:
+		default:
+			job.finish(JobFailed, ErrJobQueueFull)
+		}
+	}
+	pruneJobs()
+	return nil
+}
+
+// SubmitJob queues a prediction job for the sentences.
+func SubmitJob(modelId string, version string, sentences []string, concurrency int) (*PredictionJob, error) {
+	job := &PredictionJob{
+		info: JobInfo{
+			Id:          newId(),
+			ModelId:     modelId,
+			Version:     version,
+			Status:      JobQueued,
+			Concurrency: concurrency,
+			Total:       len(sentences),
+			CreatedAt:   time.Now(),
+		},
+		sentences: sentences,
+		done:      make(chan struct{}),
+	}
+
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	pruneJobs()
+
+	select {
+	case jobQueue <- job:
+	default:
+		return nil, ErrJobQueueFull
+	}
+	jobs[job.info.Id] = job
+	job.save()
+	return job, nil
+}
+
+// pruneJobs has to be called with the jobsLock held.
+func pruneJobs() {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for id, job := range jobs {
+		info := job.Info()
+		if info.FinishedAt != nil && time.Since(*info.FinishedAt) > jobRetention {
+			delete(jobs, id)
+			if err := utils.RemoveJob(dir, id); err != nil {
+				log.Printf("could not remove prediction job %s: %v", id, err)
+			}
+		}
+	}
+}
+
+func GetJob(id string) (*PredictionJob, bool) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	job, ok := jobs[id]
+	return job, ok
+}
+
+// GetJobs returns the jobs of the model, or all jobs if modelId is empty, the newest first.
+func GetJobs(modelId string) []JobInfo {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	pruneJobs()
+
+	infos := make([]JobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		info := job.Info()
+		if modelId == "" || info.ModelId == modelId {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].CreatedAt.After(infos[j].CreatedAt)
+	})
+	return infos
+}
+
+func (j *PredictionJob) Info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.info
+}
+
+// Page returns up to limit results starting at offset. Results of a running job are available as soon as all
+// results before them are.
+func (j *PredictionJob) Page(offset int, limit int) JobPage {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	page := JobPage{JobInfo: j.info, Offset: offset, Limit: limit, Results: []BatchResult{}}
+	if offset < len(j.results) {
+		end := offset + limit
+		if end > len(j.results) {
+			end = len(j.results)
+		}
+		page.Results = append(page.Results, j.results[offset:end]...)
+	}
+	return page
+}
+
+// Cancel stops a queued or running job, finished jobs are not changed.
+func (j *PredictionJob) Cancel() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch j.info.Status {
+	case JobQueued:
+		// the worker skips it
+		j.finishLocked(JobCancelled, nil)
+	case JobRunning:
+		j.cancelRequested = true
+		j.cancel()
+	}
+}
+
+// Wait blocks until the job is finished or ctx is done.
+func (j *PredictionJob) Wait(ctx context.Context) error {
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *PredictionJob) run(workerCtx context.Context) {
+	ctx, cancel := context.WithCancel(workerCtx)
+	defer cancel()
+
+	j.mu.Lock()
+	if j.info.Status != JobQueued {
+		j.mu.Unlock()
+		return
+	}
+	startedAt := time.Now()
+	j.info.Status = JobRunning
+	j.info.StartedAt = &startedAt
+	j.cancel = cancel
+	j.saveLocked()
+	j.mu.Unlock()
+
+	err := PredictBatch(ctx, j.info.ModelId, j.info.Version, j.sentences, j.info.Concurrency, func(result BatchResult) {
+		if result.Error != "" && ctx.Err() != nil {
+			// interrupted by the cancellation, not a failed prediction
+			return
+		}
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.results = append(j.results, result)
+		j.info.Done++
+		if result.Error != "" {
+			j.info.Failed++
+		}
+	})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case j.cancelRequested:
+		j.finishLocked(JobCancelled, nil)
+	case workerCtx.Err() != nil:
+		// the server shuts down, the saved job is still running and gets queued again after the restart
+	case err != nil:
+		j.finishLocked(JobFailed, err)
+	default:
+		j.finishLocked(JobSucceeded, nil)
+	}
+}
+
+func (j *PredictionJob) finish(status string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.finishLocked(status, err)
+}
+
+func (j *PredictionJob) finishLocked(status string, err error) {
+	finishedAt := time.Now()
+	j.info.Status = status
+	j.info.FinishedAt = &finishedAt
+	if err != nil {
+		j.info.Error = err.Error()
+	}
+	j.saveLocked()
+	close(j.done)
+}
+
+func (j *PredictionJob) save() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.saveLocked()
+}
+
+// saveLocked has to be called with the lock of the job held. Failures are only logged, the job in memory stays valid.
+func (j *PredictionJob) saveLocked() {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Printf("could not save prediction job %s: %v", j.info.Id, err)
+		return
+	}
+	record := jobRecord{Info: j.info, Sentences: j.sentences, Results: j.results}
+	if err := utils.SaveJob(dir, j.info.Id, record); err != nil {
+		log.Printf("could not save prediction job %s: %v", j.info.Id, err)
+	}
+}
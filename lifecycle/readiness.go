@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type ReadinessOptions struct {
+	// Path of the health endpoint of the model server.
+	Path string
+	// Deadline after which a container which did not become ready is marked unhealthy.
+	Deadline time.Duration
+	// InitialBackoff is the wait time after the first failed probe, it doubles up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultReadinessOptions leave enough time for the model server to import spaCy.
+var DefaultReadinessOptions = ReadinessOptions{
+	Path:           "/health",
+	Deadline:       2 * time.Minute,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+var probeClient = &http.Client{Timeout: 2 * time.Second}
+
+// waitHealthy polls the health endpoint of a tracked container until it answers with 200 and keeps the state of the
+// container in the registry up to date. It returns an error if the container exited or missed the deadline. A healthy
+// container stays in state starting until the version is loaded.
+func waitHealthy(ctx context.Context, containerId string, options ReadinessOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, options.Deadline)
+	defer cancel()
+
+	registry := helper.GetRegistry()
+	if err := registry.Transition(containerId, dockerManager.StateStarting); err != nil {
+		return err
+	}
+	backoff := options.InitialBackoff
+	for {
+		information, tracked := registry.Get(containerId)
+		if !tracked {
+			return fmt.Errorf("container %s is not tracked anymore", containerId)
+		}
+
+		status, err := helper.GetRuntime().Inspect(ctx, containerId)
+		if err == nil && !status.Running {
+			_ = registry.Transition(containerId, dockerManager.StateExited)
+			return fmt.Errorf("container %s exited before it became ready", containerId)
+		}
+
+		if probe(ctx, helper.ContainerUrl(information, options.Path)) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = registry.Transition(containerId, dockerManager.StateUnhealthy)
+			return fmt.Errorf("container %s did not become ready within %s", containerId, options.Deadline)
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > options.MaxBackoff {
+			backoff = options.MaxBackoff
+		}
+	}
+}
+
+func probe(ctx context.Context, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	res, err := probeClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+	return res.StatusCode == http.StatusOK
+}
@@ -0,0 +1,59 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"companionAI/utils"
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// StartReaper checks the tracked containers every interval and stops the ones which were idle longer than the
+// idle-timeout of their model. It runs until ctx is cancelled.
+func StartReaper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ReapIdleContainers(ctx)
+			}
+		}
+	}()
+}
+
+// ReapIdleContainers stops and untracks all containers without requests in flight whose idle timeout expired.
+func ReapIdleContainers(ctx context.Context) {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Println("could not reap idle containers:", err)
+		return
+	}
+
+	timeouts := make(map[string]time.Duration)
+	for id, information := range helper.GetRegistry().All() {
+		timeout, known := timeouts[information.ModelId]
+		if !known {
+			timeout, err = utils.IdleTimeout(dir, information.ModelId)
+			if err != nil {
+				log.Printf("could not read idle timeout of model %s: %v", information.ModelId, err)
+			}
+			timeouts[information.ModelId] = timeout
+		}
+
+		// containers whose image is still building are waited for, they are not idle
+		if timeout <= 0 || information.State == dockerManager.StateBuilding || information.InFlight > 0 || time.Since(information.LastRequest) < timeout {
+			continue
+		}
+
+		log.Printf("container %s of model %s was idle for %s", id, information.ModelId, timeout)
+		if err := StopContainer(ctx, id); err != nil {
+			log.Printf("could not stop idle container %s: %v", id, err)
+		}
+	}
+}
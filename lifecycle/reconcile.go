@@ -0,0 +1,150 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"companionAI/utils"
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DriftReport describes the differences between the saved container tracker and the containers found on the runtime.
+type DriftReport struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Tracked   int       `json:"tracked"`
+	// Gone are containers which were saved in the tracker but are no longer running.
+	Gone []string `json:"gone"`
+	// Unknown are running model containers which were not saved in the tracker, they are tracked from now on.
+	Unknown []string `json:"unknown"`
+}
+
+var (
+	reportLock sync.Mutex
+	lastReport = DriftReport{Gone: []string{}, Unknown: []string{}}
+)
+
+// Reconcile merges the labelled containers of the runtime into the container tracker and compares the result with the
+// tracker saved before the last shutdown. Tracked containers keep their state and counters, unknown running containers
+// are added and containers which are gone from the runtime are dropped.
+func Reconcile(ctx context.Context) (DriftReport, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return DriftReport{}, err
+	}
+
+	savedTracker, err := utils.LoadContainerTracker(dir)
+	if err != nil {
+		return DriftReport{}, err
+	}
+
+	// containers registered while the runtime is listed are not in the list yet and must not be dropped
+	registry := helper.GetRegistry()
+	tracked := registry.All()
+	containers, err := helper.GetRuntime().List(ctx)
+	if err != nil {
+		return DriftReport{}, err
+	}
+
+	report := DriftReport{CheckedAt: time.Now(), Gone: []string{}, Unknown: []string{}}
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		listed[container.Id] = true
+		if _, known := registry.Get(container.Id); known || !container.Running {
+			if known && container.Running {
+				registry.Update(container.Id, func(information *dockerManager.ContainerInformation) {
+					information.Ip = container.Ip
+					information.Address = container.Address
+				})
+			}
+			continue
+		}
+		information := dockerManager.ContainerInformation{
+			Port:    container.Labels[dockerManager.LabelPort],
+			ModelId: container.Labels[dockerManager.LabelModelId],
+			Version: container.Labels[dockerManager.LabelVersion],
+			Ip:      container.Ip,
+			Address: container.Address,
+			State:   dockerManager.StateStarting,
+			// the last request before the restart is unknown, the idle timeout starts over
+			LastRequest: time.Now(),
+		}
+		registry.Register(container.Id, information)
+		// the model server may have lost the loaded version with a restart of its own
+		WatchLoading(container.Id, information, information.Version, DefaultReadinessOptions)
+		if _, saved := savedTracker[container.Id]; !saved {
+			report.Unknown = append(report.Unknown, container.Id)
+		}
+	}
+
+	for id, information := range tracked {
+		// images which are still building have no container yet
+		if !listed[id] && information.State != dockerManager.StateBuilding {
+			registry.Remove(id)
+		}
+	}
+
+	for id := range savedTracker {
+		if _, running := registry.Get(id); !running {
+			report.Gone = append(report.Gone, id)
+		}
+	}
+	report.Tracked = len(registry.All())
+
+	reportLock.Lock()
+	lastReport = report
+	reportLock.Unlock()
+
+	// the addresses are updated without notifying the subscribers of the registry
+	PersistContainers()
+	return report, nil
+}
+
+// LastDriftReport returns the report of the latest call to Reconcile.
+func LastDriftReport() DriftReport {
+	reportLock.Lock()
+	defer reportLock.Unlock()
+	return lastReport
+}
+
+// PersistOnChange saves the container tracker whenever a container is registered, changes its state or is removed,
+// until ctx is cancelled. Changes arriving while the tracker is saved are saved together. The returned channel is
+// closed once the last save finished, the tracker can be saved safely afterwards.
+func PersistOnChange(ctx context.Context) <-chan struct{} {
+	changes, unsubscribe := helper.GetRegistry().Subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changes:
+			}
+			for pending := true; pending; {
+				select {
+				case <-changes:
+				default:
+					pending = false
+				}
+			}
+			PersistContainers()
+		}
+	}()
+	return done
+}
+
+// PersistContainers saves the current container tracker. Failures are only logged, the tracker in memory stays valid.
+func PersistContainers() {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Println("could not persist container tracker:", err)
+		return
+	}
+	if err := utils.SaveContainerTracker(dir, helper.GetRegistry().All()); err != nil {
+		log.Println("could not persist container tracker:", err)
+	}
+}
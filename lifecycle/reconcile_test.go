@@ -0,0 +1,88 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"companionAI/utils"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReconcileAdoptsUnknownContainers(t *testing.T) {
+	tests := []struct {
+		name       string
+		loadStatus int
+		wantState  string
+	}{
+		{name: "version loaded", loadStatus: http.StatusOK, wantState: dockerManager.StateReady},
+		{name: "version not loaded", loadStatus: http.StatusInternalServerError, wantState: dockerManager.StateUnhealthy},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &modelServer{loadStatus: test.loadStatus}
+			runtime := setupModel(t, server, utils.Config{})
+
+			// started by the server before its restart
+			if err := runtime.Build(context.Background(), ".", []string{"m1"}, nil, io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			id, err := runtime.Start(context.Background(), dockerManager.StartOptions{Image: "m1", Port: "5000", Labels: dockerManager.ModelLabels("m1", "v1", "5000")})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := Reconcile(context.Background())
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if len(report.Unknown) != 1 || report.Unknown[0] != id {
+				t.Errorf("Reconcile() unknown = %v, want [%s]", report.Unknown, id)
+			}
+
+			settled := eventually(2*time.Second, func() bool {
+				information, _ := helper.GetRegistry().Get(id)
+				return information.State == test.wantState
+			})
+			if !settled {
+				information, _ := helper.GetRegistry().Get(id)
+				t.Fatalf("container is in state %s, want %s", information.State, test.wantState)
+			}
+			if got := atomic.LoadInt32(&server.loads); got != 1 {
+				t.Errorf("version was loaded %d times, want 1", got)
+			}
+		})
+	}
+}
+
+func TestPersistOnChange(t *testing.T) {
+	setupModel(t, &modelServer{loadStatus: http.StatusOK}, utils.Config{})
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := PersistOnChange(ctx)
+	helper.GetRegistry().Register("c1", dockerManager.ContainerInformation{ModelId: "m1", Version: "v1"})
+
+	saved := eventually(time.Second, func() bool {
+		tracker, err := utils.LoadContainerTracker(dir)
+		return err == nil && len(tracker) == 1
+	})
+	if !saved {
+		t.Fatal("the registered container was not saved")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("PersistOnChange() did not finish after ctx was cancelled")
+	}
+}
@@ -0,0 +1,208 @@
+package lifecycle
+
+import (
+	"companionAI/utils"
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxShadowRequests caps the shadow predictions running at the same time, further copies are skipped.
+const maxShadowRequests = 16
+
+// maxDisagreements is the number of disagreements kept per version pair.
+const maxDisagreements = 100
+
+// shadowTimeout bounds a shadow prediction including the start of a container for the shadow version.
+const shadowTimeout = 5 * time.Minute
+
+// Disagreement is a prediction where the shadow version answered differently than the version which served it.
+type Disagreement struct {
+	Time     time.Time       `json:"time"`
+	Sentence string          `json:"sentence"`
+	Primary  json.RawMessage `json:"primary"`
+	Shadow   json.RawMessage `json:"shadow,omitempty"`
+	// Error is set if the shadow version could not predict the sentence.
+	Error string `json:"error,omitempty"`
+}
+
+// ShadowComparison compares the answers of a shadow version with those of the version serving the predictions.
+type ShadowComparison struct {
+	ModelId       string `json:"modelId"`
+	Version       string `json:"version"`
+	ShadowVersion string `json:"shadowVersion"`
+	Compared      int    `json:"compared"`
+	Agreed        int    `json:"agreed"`
+	Disagreed     int    `json:"disagreed"`
+	Failed        int    `json:"failed"`
+	// Skipped counts the copies which were dropped because too many shadow predictions were running.
+	Skipped int `json:"skipped"`
+	// Disagreements are the latest disagreements and failures, the oldest first.
+	Disagreements []Disagreement `json:"disagreements"`
+}
+
+var (
+	shadowLock        sync.Mutex
+	shadowComparisons = make(map[string]*ShadowComparison)
+	shadowSlots       = make(chan struct{}, maxShadowRequests)
+)
+
+// RouteVersion picks the version serving a prediction of the model by the weights of its routing, and the shadow
+// version which gets a copy of the prediction. The shadow version is empty if no copy is sent.
+func RouteVersion(modelId string) (version string, shadow string, err error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+	config, err := utils.LoadConfig(dir, modelId)
+	if err != nil {
+		return "", "", err
+	}
+
+	version = config.NewestVersion
+	routing := config.Routing
+	if routing == nil {
+		return version, "", nil
+	}
+
+	if len(routing.Weights) > 0 {
+		versions := make([]string, 0, len(routing.Weights))
+		total := 0
+		for v, weight := range routing.Weights {
+			versions = append(versions, v)
+			total += weight
+		}
+		sort.Strings(versions)
+
+		// SetRouting rejects weights without a total, a config edited by hand falls back to the newest version
+		if total > 0 {
+			pick := rand.Intn(total)
+			for _, v := range versions {
+				pick -= routing.Weights[v]
+				if pick < 0 {
+					version = v
+					break
+				}
+			}
+		}
+	}
+
+	if routing.Shadow != nil && routing.Shadow.Version != version && rand.Float64()*100 < routing.Shadow.Percent {
+		shadow = routing.Shadow.Version
+	}
+	return version, shadow, nil
+}
+
+// MirrorPrediction predicts the sentence with the shadow version in the background and compares the answer with the
+// answer of the version which served the prediction.
+func MirrorPrediction(modelId string, version string, shadowVersion string, sentence string, primary []byte) {
+	comparison := shadowComparison(modelId, version, shadowVersion)
+
+	select {
+	case shadowSlots <- struct{}{}:
+	default:
+		shadowLock.Lock()
+		comparison.Skipped++
+		shadowLock.Unlock()
+		return
+	}
+
+	go func() {
+		defer func() { <-shadowSlots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+		defer cancel()
+
+		strategy := ""
+		if dir, err := os.Getwd(); err == nil {
+			if config, err := utils.LoadConfig(dir, modelId); err == nil {
+				strategy = config.LoadBalancing
+			}
+		}
+		result := predictSentence(ctx, modelId, shadowVersion, strategy, sentence)
+
+		shadowLock.Lock()
+		defer shadowLock.Unlock()
+		comparison.Compared++
+
+		disagreement := Disagreement{Time: time.Now(), Sentence: sentence, Primary: primary, Shadow: result.Prediction}
+		switch {
+		case result.Error != "":
+			comparison.Failed++
+			disagreement.Error = result.Error
+			log.Printf("shadow prediction of model %s version %s failed: %s", modelId, shadowVersion, result.Error)
+		case sameAnswer(primary, result.Prediction):
+			comparison.Agreed++
+			return
+		default:
+			comparison.Disagreed++
+		}
+
+		comparison.Disagreements = append(comparison.Disagreements, disagreement)
+		if len(comparison.Disagreements) > maxDisagreements {
+			comparison.Disagreements = comparison.Disagreements[len(comparison.Disagreements)-maxDisagreements:]
+		}
+	}()
+}
+
+func shadowComparison(modelId string, version string, shadowVersion string) *ShadowComparison {
+	shadowLock.Lock()
+	defer shadowLock.Unlock()
+
+	key := modelId + "/" + version + "/" + shadowVersion
+	comparison, ok := shadowComparisons[key]
+	if !ok {
+		comparison = &ShadowComparison{ModelId: modelId, Version: version, ShadowVersion: shadowVersion, Disagreements: []Disagreement{}}
+		shadowComparisons[key] = comparison
+	}
+	return comparison
+}
+
+// sameAnswer compares two json answers regardless of their formatting and key order.
+func sameAnswer(a []byte, b []byte) bool {
+	var first, second interface{}
+	if json.Unmarshal(a, &first) != nil || json.Unmarshal(b, &second) != nil {
+		return string(a) == string(b)
+	}
+	return reflect.DeepEqual(first, second)
+}
+
+// ShadowReport returns the comparisons of the shadow versions of the model with the versions serving its predictions.
+func ShadowReport(modelId string) []ShadowComparison {
+	shadowLock.Lock()
+	defer shadowLock.Unlock()
+
+	report := []ShadowComparison{}
+	for _, comparison := range shadowComparisons {
+		if comparison.ModelId != modelId {
+			continue
+		}
+		copied := *comparison
+		copied.Disagreements = append([]Disagreement{}, comparison.Disagreements...)
+		report = append(report, copied)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Version != report[j].Version {
+			return report[i].Version < report[j].Version
+		}
+		return report[i].ShadowVersion < report[j].ShadowVersion
+	})
+	return report
+}
+
+// ResetShadowReport drops the comparisons of the model, e.g. after a new shadow version was trained.
+func ResetShadowReport(modelId string) {
+	shadowLock.Lock()
+	defer shadowLock.Unlock()
+	for key, comparison := range shadowComparisons {
+		if comparison.ModelId == modelId {
+			delete(shadowComparisons, key)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrAlreadyRunning = errors.New("a container of the model version is already running")
+
+var (
+	versionLocksLock sync.Mutex
+	versionLocks     = make(map[string]*sync.Mutex)
+)
+
+// lockVersion serializes the changes to the number of containers of a model version, so two callers do not both see
+// too few replicas and start one each. The returned function unlocks the version again.
+func lockVersion(modelId string, version string) func() {
+	key := modelId + "/" + version
+	versionLocksLock.Lock()
+	lock, ok := versionLocks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		versionLocks[key] = lock
+	}
+	versionLocksLock.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// StartUnlessRunning starts a container of the model version like StartModel, unless one is tracked already. Then it
+// returns ErrAlreadyRunning.
+func StartUnlessRunning(ctx context.Context, modelId string, version string) (string, dockerManager.ContainerInformation, error) {
+	defer lockVersion(modelId, version)()
+
+	if len(helper.Replicas(modelId, version)) > 0 {
+		return "", dockerManager.ContainerInformation{}, ErrAlreadyRunning
+	}
+	return StartModel(ctx, modelId, version)
+}
+
+// ScaleModel starts or stops containers until replicas containers of the model version are tracked. New replicas
+// are waited for and get the version loaded in the background. The ids of all replicas are returned.
+func ScaleModel(ctx context.Context, modelId string, version string, replicas int, readiness ReadinessOptions) ([]string, error) {
+	defer lockVersion(modelId, version)()
+
+	current := helper.Replicas(modelId, version)
+
+	for i := len(current); i < replicas; i++ {
+		id, information, err := StartModel(ctx, modelId, version)
+		if err != nil {
+			return helper.Replicas(modelId, version), err
+		}
+		WatchLoading(id, information, version, readiness)
+	}
+
+	if len(current) > replicas {
+		// stop the replicas which are not serving first, then the least busy ones
+		sort.SliceStable(current, func(i, j int) bool {
+			first, _ := helper.GetRegistry().Get(current[i])
+			second, _ := helper.GetRegistry().Get(current[j])
+			if (first.State == dockerManager.StateReady) != (second.State == dockerManager.StateReady) {
+				return second.State == dockerManager.StateReady
+			}
+			return first.InFlight < second.InFlight
+		})
+		for _, id := range current[:len(current)-replicas] {
+			if err := StopContainer(ctx, id); err != nil {
+				return helper.Replicas(modelId, version), err
+			}
+		}
+	}
+
+	return helper.Replicas(modelId, version), nil
+}
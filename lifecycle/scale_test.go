@@ -0,0 +1,86 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"companionAI/utils"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentStarts(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls int
+		// start is made by every call at the same time
+		start        func() error
+		wantReplicas int
+	}{
+		{
+			name:  "start unless running",
+			calls: 10,
+			start: func() error {
+				id, information, err := StartUnlessRunning(context.Background(), "m1", "v1")
+				if errors.Is(err, ErrAlreadyRunning) {
+					return nil
+				}
+				if err == nil {
+					WatchLoading(id, information, "v1", testReadiness)
+				}
+				return err
+			},
+			wantReplicas: 1,
+		},
+		{
+			name:  "scale",
+			calls: 10,
+			start: func() error {
+				_, err := ScaleModel(context.Background(), "m1", "v1", 2, testReadiness)
+				return err
+			},
+			wantReplicas: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupModel(t, &modelServer{loadStatus: http.StatusOK}, utils.Config{})
+
+			errs := make([]error, test.calls)
+			// the calls wait for each other, so they check the replicas at the same time
+			begin := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < test.calls; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					<-begin
+					errs[i] = test.start()
+				}(i)
+			}
+			close(begin)
+			wg.Wait()
+
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("call %d error = %v", i, err)
+				}
+			}
+			if got := len(helper.Replicas("m1", "v1")); got != test.wantReplicas {
+				t.Errorf("got %d replicas, want %d", got, test.wantReplicas)
+			}
+
+			// the replicas load the version in the background, they must not outlive the runtime of the test
+			loaded := eventually(2*time.Second, func() bool {
+				return len(helper.GetRegistry().InState("m1", "v1", dockerManager.StateReady)) == test.wantReplicas
+			})
+			if !loaded {
+				t.Error("the replicas did not become ready")
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"companionAI/utils"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// StartModel builds the image of the model and starts a container for the given version. While the image builds,
+// the container is tracked in state building under a placeholder id. The started container is tracked in state
+// starting, it is up to the caller to wait for its readiness.
+func StartModel(ctx context.Context, modelId string, version string) (string, dockerManager.ContainerInformation, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", dockerManager.ContainerInformation{}, err
+	}
+
+	limits, err := utils.LoadResourceLimits(dir, modelId)
+	if err != nil {
+		return "", dockerManager.ContainerInformation{}, fmt.Errorf("invalid resources for model %s: %w", modelId, err)
+	}
+
+	ports := helper.GetPortAllocator()
+	port, err := ports.Reserve()
+	if err != nil {
+		return "", dockerManager.ContainerInformation{}, err
+	}
+	// once the container is registered, the registry holds the port until the container is stopped
+	defer ports.Release(port)
+
+	registry := helper.GetRegistry()
+	buildId := "building-" + port
+	information := dockerManager.ContainerInformation{
+		Port:        port,
+		ModelId:     modelId,
+		Version:     version,
+		State:       dockerManager.StateBuilding,
+		LastRequest: time.Now(),
+	}
+	registry.Register(buildId, information)
+	started := false
+	defer func() {
+		if !started {
+			_ = registry.Transition(buildId, dockerManager.StateFailed)
+			registry.Remove(buildId)
+		}
+	}()
+
+	build, err := BuildModelImage(ctx, modelId)
+	if err != nil {
+		return "", dockerManager.ContainerInformation{}, err
+	}
+	if err := build.Wait(ctx); err != nil {
+		return "", dockerManager.ContainerInformation{}, fmt.Errorf("build %s failed: %w", build.Info().Id, err)
+	}
+
+	runtime := helper.GetRuntime()
+
+	// only docker containers mount the model folder from the host
+	sourceMountPath := ""
+	if hostDir := helper.GetHostDir(); hostDir != "" {
+		sourceMountPath = hostDir + "/models/" + modelId
+	}
+
+	id, err := runtime.Start(ctx, dockerManager.StartOptions{
+		Image:           build.Info().Image,
+		SourceMountPath: sourceMountPath,
+		TargetMountPath: "/mnt",
+		Port:            port,
+		Labels:          dockerManager.ModelLabels(modelId, version, port),
+		Resources:       limits,
+	})
+	if err != nil {
+		return "", dockerManager.ContainerInformation{}, err
+	}
+
+	status, err := runtime.Inspect(ctx, id)
+	if err != nil {
+		// the container is not registered yet, nobody else would stop it
+		if stopErr := runtime.Stop(context.Background(), id); stopErr != nil {
+			log.Printf("could not stop container %s: %v", id, stopErr)
+		}
+		return "", dockerManager.ContainerInformation{}, fmt.Errorf("error while trying to get containerIp %w", err)
+	}
+
+	information.Ip = status.Ip
+	information.Address = status.Address
+	information.State = dockerManager.StateStarting
+	information.LastRequest = time.Now()
+	if err := registry.Started(buildId, id, information); err != nil {
+		// the placeholder was stopped while the image was building
+		if stopErr := runtime.Stop(context.Background(), id); stopErr != nil {
+			log.Printf("could not stop container %s: %v", id, stopErr)
+		}
+		return "", dockerManager.ContainerInformation{}, err
+	}
+	started = true
+
+	return id, information, nil
+}
+
+type coldStart struct {
+	done        chan struct{}
+	id          string
+	information dockerManager.ContainerInformation
+	err         error
+}
+
+var (
+	coldStartLock sync.Mutex
+	coldStarts    = make(map[string]*coldStart)
+)
+
+// EnsureReady returns a ready container of the model version. If there is none, a container is started, waited for
+// and the version is loaded into it. Concurrent calls for the same model version share a single cold start.
+func EnsureReady(ctx context.Context, modelId string, version string, readiness ReadinessOptions) (string, dockerManager.ContainerInformation, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", dockerManager.ContainerInformation{}, err
+	}
+	config, err := utils.LoadConfig(dir, modelId)
+	if err != nil {
+		return "", dockerManager.ContainerInformation{}, err
+	}
+
+	if id, information, ok := helper.PickReplica(modelId, version, config.LoadBalancing); ok {
+		return id, information, nil
+	}
+
+	key := modelId + "/" + version
+	coldStartLock.Lock()
+	call, running := coldStarts[key]
+	if !running {
+		call = &coldStart{done: make(chan struct{})}
+		coldStarts[key] = call
+		go func() {
+			// the start must not be cancelled by the client which happened to trigger it
+			call.id, call.information, call.err = startAndLoad(context.Background(), modelId, version, readiness)
+			if replicas, ok := config.Replicas[version]; ok && replicas > 1 && call.err == nil {
+				go func() {
+					if _, err := ScaleModel(context.Background(), modelId, version, replicas, readiness); err != nil {
+						log.Printf("could not scale model %s %s to %d replicas: %v", modelId, version, replicas, err)
+					}
+				}()
+			}
+			coldStartLock.Lock()
+			delete(coldStarts, key)
+			coldStartLock.Unlock()
+			close(call.done)
+		}()
+	}
+	coldStartLock.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", dockerManager.ContainerInformation{}, ctx.Err()
+	case <-call.done:
+		return call.id, call.information, call.err
+	}
+}
+
+func startAndLoad(ctx context.Context, modelId string, version string, readiness ReadinessOptions) (string, dockerManager.ContainerInformation, error) {
+	id, information, err := StartModel(ctx, modelId, version)
+	if err != nil {
+		return "", dockerManager.ContainerInformation{}, err
+	}
+
+	if err := WaitUntilLoaded(ctx, id, information, version, readiness); err != nil {
+		// nobody else would stop the container, it never became ready
+		if stopErr := StopContainer(context.Background(), id); stopErr != nil {
+			log.Printf("could not stop container %s: %v", id, stopErr)
+		}
+		return "", dockerManager.ContainerInformation{}, err
+	}
+
+	information, _ = helper.GetRegistry().Get(id)
+	return id, information, nil
+}
+
+// WaitUntilLoaded waits for the health of the container and loads the version into it. The container is only marked
+// as ready afterwards, so no prediction is routed to a model server without the version. Containers which could not
+// load the version are marked as unhealthy.
+func WaitUntilLoaded(ctx context.Context, containerId string, information dockerManager.ContainerInformation, version string, readiness ReadinessOptions) error {
+	if err := waitHealthy(ctx, containerId, readiness); err != nil {
+		return err
+	}
+	if err := loadVersion(ctx, information, version); err != nil {
+		_ = helper.GetRegistry().Transition(containerId, dockerManager.StateUnhealthy)
+		return err
+	}
+	// fails if the container is stopped in the meantime
+	return helper.GetRegistry().Transition(containerId, dockerManager.StateReady)
+}
+
+// WatchLoading runs WaitUntilLoaded in the background and only logs the result.
+func WatchLoading(containerId string, information dockerManager.ContainerInformation, version string, readiness ReadinessOptions) {
+	go func() {
+		if err := WaitUntilLoaded(context.Background(), containerId, information, version, readiness); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+// loadVersion makes the model server inside the container load the trained version.
+func loadVersion(ctx context.Context, information dockerManager.ContainerInformation, version string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, helper.ContainerUrl(information, "/load/"+version), nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not load version %s: %w", version, err)
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("could not load version %s: container answered %s", version, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"companionAI/utils"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testReadiness = ReadinessOptions{
+	Path:           "/health",
+	Deadline:       2 * time.Second,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     50 * time.Millisecond,
+}
+
+// modelServer stands in for the model server inside the containers of the fake runtime.
+type modelServer struct {
+	loads int32
+	// loadStatus is the status /load answers with.
+	loadStatus int
+}
+
+func (s *modelServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/health":
+		w.WriteHeader(http.StatusOK)
+	case "/load/v1":
+		// slow enough for concurrent calls to arrive during the cold start
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&s.loads, 1)
+		w.WriteHeader(s.loadStatus)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var (
+	containerTransport sync.Once
+	// containerAddress is the address of the model server of the running test.
+	containerAddress atomic.Value
+)
+
+// serveContainers sends the requests to the containers, whatever their address is, to the model server.
+func serveContainers(t *testing.T, server *modelServer) {
+	t.Helper()
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	containerAddress.Store(httpServer.Listener.Addr().String())
+
+	containerTransport.Do(func() {
+		transport := &http.Transport{DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, containerAddress.Load().(string))
+		}}
+		probeClient.Transport = transport
+		http.DefaultClient.Transport = transport
+	})
+}
+
+// setupModel runs the test in a folder with the model m1 and a fake runtime whose containers are served by server.
+func setupModel(t *testing.T, server *modelServer, config utils.Config) *dockerManager.FakeRuntime {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := os.MkdirAll(dir+"/mnt/models/m1", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir+"/mnt/models/m1/Dockerfile", []byte("FROM python\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.NewestVersion = "v1"
+	if err := utils.Save(dir+"/mnt/models/m1/config.json", config); err != nil {
+		t.Fatal(err)
+	}
+
+	serveContainers(t, server)
+	runtime := dockerManager.NewFakeRuntime()
+	helper.SetRuntime(runtime)
+	t.Cleanup(func() {
+		for id := range helper.GetRegistry().All() {
+			helper.GetRegistry().Remove(id)
+		}
+	})
+	return runtime
+}
+
+func TestEnsureReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		loadStatus int
+		// calls are made at the same time
+		calls int
+		// sequential calls are made one after another
+		sequential     bool
+		wantErr        bool
+		wantContainers int
+		wantLoads      int32
+	}{
+		{name: "single call", loadStatus: http.StatusOK, calls: 1, wantContainers: 1, wantLoads: 1},
+		{name: "concurrent calls share the cold start", loadStatus: http.StatusOK, calls: 10, wantContainers: 1, wantLoads: 1},
+		{name: "ready container is reused", loadStatus: http.StatusOK, calls: 3, sequential: true, wantContainers: 1, wantLoads: 1},
+		{name: "failed load stops the container", loadStatus: http.StatusInternalServerError, calls: 3, wantErr: true, wantContainers: 0, wantLoads: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &modelServer{loadStatus: test.loadStatus}
+			runtime := setupModel(t, server, utils.Config{})
+
+			ids := make([]string, test.calls)
+			errs := make([]error, test.calls)
+			var wg sync.WaitGroup
+			for i := 0; i < test.calls; i++ {
+				wg.Add(1)
+				call := func(i int) {
+					defer wg.Done()
+					ids[i], _, errs[i] = EnsureReady(context.Background(), "m1", "v1", testReadiness)
+				}
+				if test.sequential {
+					call(i)
+				} else {
+					go call(i)
+				}
+			}
+			wg.Wait()
+
+			for i := range errs {
+				if (errs[i] != nil) != test.wantErr {
+					t.Fatalf("EnsureReady() call %d error = %v, want error %v", i, errs[i], test.wantErr)
+				}
+				if ids[i] != ids[0] {
+					t.Errorf("EnsureReady() call %d returned container %q, want %q like the first call", i, ids[i], ids[0])
+				}
+			}
+
+			if got := len(helper.GetRegistry().ByVersion("m1", "v1")); got != test.wantContainers {
+				t.Errorf("got %d tracked containers, want %d", got, test.wantContainers)
+			}
+			if got := atomic.LoadInt32(&server.loads); got != test.wantLoads {
+				t.Errorf("version was loaded %d times, want %d", got, test.wantLoads)
+			}
+
+			containers, err := runtime.List(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			running := 0
+			for _, container := range containers {
+				if container.Running {
+					running++
+				}
+			}
+			if running != test.wantContainers {
+				t.Errorf("got %d running containers, want %d", running, test.wantContainers)
+			}
+		})
+	}
+}
+
+func TestWatchLoading(t *testing.T) {
+	tests := []struct {
+		name       string
+		loadStatus int
+		wantState  string
+	}{
+		{name: "loaded", loadStatus: http.StatusOK, wantState: dockerManager.StateReady},
+		{name: "load failed", loadStatus: http.StatusInternalServerError, wantState: dockerManager.StateUnhealthy},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &modelServer{loadStatus: test.loadStatus}
+			setupModel(t, server, utils.Config{})
+
+			id, information, err := StartModel(context.Background(), "m1", "v1")
+			if err != nil {
+				t.Fatalf("StartModel() error = %v", err)
+			}
+			WatchLoading(id, information, "v1", testReadiness)
+
+			pickedEarly := false
+			settled := eventually(2*time.Second, func() bool {
+				// no prediction may be routed to the container before the version is loaded
+				if _, _, picked := helper.PickReplica("m1", "v1", ""); picked && atomic.LoadInt32(&server.loads) == 0 {
+					pickedEarly = true
+				}
+				information, _ := helper.GetRegistry().Get(id)
+				return information.State == test.wantState
+			})
+			if !settled {
+				information, _ := helper.GetRegistry().Get(id)
+				t.Fatalf("container is in state %s, want %s", information.State, test.wantState)
+			}
+			if pickedEarly {
+				t.Error("PickReplica() picked the container before the version was loaded")
+			}
+			if got := atomic.LoadInt32(&server.loads); got != 1 {
+				t.Errorf("version was loaded %d times, want 1", got)
+			}
+		})
+	}
+}
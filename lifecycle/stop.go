@@ -0,0 +1,50 @@
+package lifecycle
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// StopContainer stops a container and removes it from the registry. It is marked as stopping first, so the event
+// watcher does not mistake the stop for a crash. Containers which could not be stopped are marked as failed. A
+// container whose image is still building is only removed, it is not started once the build finished.
+func StopContainer(ctx context.Context, containerId string) error {
+	registry := helper.GetRegistry()
+	if information, _ := registry.Get(containerId); information.State == dockerManager.StateBuilding {
+		if err := registry.Transition(containerId, dockerManager.StateStopping); err != nil {
+			return err
+		}
+		_ = registry.Transition(containerId, dockerManager.StateStopped)
+		registry.Remove(containerId)
+		return nil
+	}
+	if err := registry.Transition(containerId, dockerManager.StateStopping); err != nil && !errors.Is(err, helper.ErrNotRegistered) {
+		return err
+	}
+	err := helper.GetRuntime().Stop(ctx, containerId)
+	if errors.Is(err, dockerManager.ErrNotFound) {
+		// removed behind the back of the server, only registered containers count as stopped
+		if _, registered := registry.Get(containerId); !registered {
+			return err
+		}
+	} else if err != nil {
+		_ = registry.Transition(containerId, dockerManager.StateFailed)
+		return err
+	}
+	_ = registry.Transition(containerId, dockerManager.StateStopped)
+	registry.Remove(containerId)
+	return nil
+}
+
+// StopAll stops every tracked container.
+func StopAll(ctx context.Context) error {
+	for id := range helper.GetRegistry().All() {
+		if err := StopContainer(ctx, id); err != nil {
+			return fmt.Errorf("could not stop container %s: %w", id, err)
+		}
+	}
+	return nil
+}
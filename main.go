@@ -1,8 +1,22 @@
 package main
 
 import (
+	"companionAI/dockerManager"
 	"companionAI/docs"
 	"companionAI/groups"
+	"companionAI/helper"
+	"companionAI/lifecycle"
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -18,23 +32,129 @@ func main() {
 	docs.SwaggerInfo.BasePath = "/api/v1"
 	docs.SwaggerInfo.Schemes = []string{"http"}
 
+	if len(os.Args) > 1 {
+		helper.SetHostDir(os.Args[1])
+	}
+
+	// the traffic split between model versions is random
+	rand.Seed(time.Now().UnixNano())
+
+	// COMPANION_RUNTIME=fake runs the model lifecycle in memory without a docker daemon, COMPANION_RUNTIME=process runs
+	// the model servers as child processes
+	switch os.Getenv("COMPANION_RUNTIME") {
+	case "fake":
+		helper.SetRuntime(dockerManager.NewFakeRuntime())
+	case "process":
+		helper.SetRuntime(dockerManager.NewProcessRuntime())
+	default:
+		// the containers mount their model folder from the host, the server itself runs in a container
+		if helper.GetHostDir() == "" {
+			log.Fatal("the docker runtime needs the host path of the mnt folder as first argument")
+		}
+		runtime, err := dockerManager.NewDockerRuntime()
+		if err != nil {
+			log.Fatal(err)
+		}
+		helper.SetRuntime(runtime)
+	}
+
+	if portRange := os.Getenv("COMPANION_PORT_RANGE"); portRange != "" {
+		min, max, err := helper.ParsePortRange(portRange)
+		if err != nil {
+			log.Fatal(err)
+		}
+		helper.SetPortAllocator(helper.NewPortAllocator(min, max))
+	}
+
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	persisted := lifecycle.PersistOnChange(background)
+
+	// containers started before a restart of the server are still running, take them over again
+	if _, err := lifecycle.Reconcile(context.Background()); err != nil {
+		log.Println("could not reconcile running containers:", err)
+	}
+
+	reaperInterval := time.Minute
+	if interval, err := time.ParseDuration(os.Getenv("COMPANION_REAPER_INTERVAL")); err == nil {
+		reaperInterval = interval
+	}
+	lifecycle.StartReaper(background, reaperInterval)
+	lifecycle.WatchEvents(background)
+
+	// COMPANION_GC_INTERVAL=0 turns the scheduled garbage collection off
+	gcInterval := time.Hour
+	if interval, err := time.ParseDuration(os.Getenv("COMPANION_GC_INTERVAL")); err == nil {
+		gcInterval = interval
+	}
+	if gcInterval > 0 {
+		lifecycle.StartGarbageCollector(background, gcInterval)
+	}
+
+	jobWorkers := 2
+	if workers, err := strconv.Atoi(os.Getenv("COMPANION_JOB_WORKERS")); err == nil && workers > 0 {
+		jobWorkers = workers
+	}
+	jobRetention := 24 * time.Hour
+	if retention, err := time.ParseDuration(os.Getenv("COMPANION_JOB_RETENTION")); err == nil {
+		jobRetention = retention
+	}
+	if err := lifecycle.StartJobWorkers(background, jobWorkers, jobRetention); err != nil {
+		log.Println("could not load prediction jobs:", err)
+	}
+
+	// COMPANION_CACHE_SIZE=0 turns the prediction cache off
+	if size, err := strconv.Atoi(os.Getenv("COMPANION_CACHE_SIZE")); err == nil && size >= 0 {
+		helper.SetPredictionCache(helper.NewPredictionCache(size))
+	}
+	if os.Getenv("COMPANION_CACHE_PERSIST") == "true" {
+		if err := lifecycle.LoadPredictionCache(); err != nil {
+			log.Println("could not load prediction cache:", err)
+		}
+	}
+
+	if value := os.Getenv("COMPANION_RATE_LIMITS"); value != "" {
+		limits, err := helper.ParseRateLimits(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		helper.SetRateLimiter(helper.NewRateLimiter(limits))
+	}
+	// only set behind a proxy which sets X-Client-Id, clients could bypass the limits by changing it otherwise
+	helper.SetTrustClientId(os.Getenv("COMPANION_TRUST_CLIENT_ID") == "true")
+
 	server := gin.Default()
 
 	v1 := server.Group("/api/v1")
 	{
 		modelGroup := v1.Group("/model")
 		{
-			modelGroup.POST("/predict/:containerId", groups.PredictData)
-			modelGroup.PUT("/train/:containerId", groups.TrainModel)
+			modelGroup.POST("/predict/:containerId", groups.RateLimit(), groups.PredictData)
+			modelGroup.PUT("/train/:containerId", groups.TrainingQuota(), groups.TrainModel)
 			modelGroup.PUT("/load/:containerId", groups.LoadModel)
 			modelGroup.POST("/create", groups.CreateNewModel)
 			modelGroup.DELETE("/:modelId", groups.RemoveModel)
 			modelGroup.GET("/:modelId", groups.ModelInformation)
+			modelGroup.GET("/:modelId/logs", groups.ContainerLogs)
 			modelGroup.POST("/:modelId/:modelVersion/start", groups.StartContainer)
+			modelGroup.POST("/:modelId/:modelVersion/predict", groups.RateLimit(), groups.PredictModelVersion)
+			modelGroup.POST("/:modelId/predict", groups.RateLimit(), groups.PredictModel)
+			// batches and jobs take a token per sentence once they are read
+			modelGroup.POST("/:modelId/:modelVersion/batch", groups.PredictBatch)
+			modelGroup.POST("/:modelId/:modelVersion/jobs", groups.SubmitJob)
+			modelGroup.POST("/:modelId/:modelVersion/scale", groups.ScaleContainers)
 			modelGroup.PUT("/:containerId/stop", groups.EndContainer)
 			modelGroup.GET("/:modelId/labels", groups.GetLabels)
 			modelGroup.POST("/:modelId/labels", groups.AddLabels)
 			modelGroup.DELETE("/:modelId/labels", groups.RemoveLabels)
+			modelGroup.POST("/:modelId/resources", groups.SetResources)
+			modelGroup.POST("/:modelId/build", groups.BuildModel)
+			modelGroup.POST("/:modelId/capture", groups.SetCapture)
+			modelGroup.GET("/:modelId/captures", groups.GetCaptures)
+			modelGroup.POST("/:modelId/captures/promote", groups.PromoteCaptures)
+			modelGroup.POST("/:modelId/routing", groups.SetRouting)
+			modelGroup.GET("/:modelId/shadow", groups.GetShadowReport)
+			modelGroup.DELETE("/:modelId/shadow", groups.ResetShadowReport)
 
 		}
 
@@ -46,6 +166,37 @@ func main() {
 			modelsGroup.GET("/runningContainers", groups.GetRunningContainers)
 		}
 
+		buildsGroup := v1.Group("/builds")
+		{
+			buildsGroup.GET("", groups.GetBuilds)
+			buildsGroup.GET("/:buildId", groups.GetBuild)
+			buildsGroup.GET("/:buildId/logs", groups.StreamBuildLogs)
+			buildsGroup.DELETE("/:buildId", groups.CancelBuild)
+		}
+
+		jobsGroup := v1.Group("/jobs")
+		{
+			jobsGroup.GET("", groups.GetJobs)
+			jobsGroup.GET("/:jobId", groups.GetJob)
+			jobsGroup.DELETE("/:jobId", groups.CancelJob)
+		}
+
+		adminGroup := v1.Group("/admin")
+		{
+			adminGroup.GET("/containers/drift", groups.GetContainerDrift)
+			adminGroup.POST("/containers/reconcile", groups.ReconcileContainers)
+			adminGroup.GET("/gc", groups.GetGarbageReport)
+			adminGroup.POST("/gc", groups.CollectGarbage)
+			adminGroup.GET("/cache", groups.GetCacheStats)
+			adminGroup.DELETE("/cache", groups.ClearCache)
+			adminGroup.GET("/limits", groups.GetRateLimits)
+			adminGroup.PUT("/limits", groups.SetDefaultRateLimits)
+			adminGroup.PUT("/limits/models/:modelId", groups.SetModelRateLimits)
+			adminGroup.DELETE("/limits/models/:modelId", groups.RemoveModelRateLimits)
+			adminGroup.GET("/limits/usage", groups.GetRateLimitUsage)
+			adminGroup.DELETE("/limits/usage/:client", groups.ResetRateLimitUsage)
+		}
+
 		dataGroup := v1.Group("/data")
 		{
 			dataGroup.POST("/entity_extraction/:modelId", groups.AddDataPoints)
@@ -56,5 +207,62 @@ func main() {
 
 	server.GET("swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	server.Run()
+	serve(server, func() {
+		stopBackground()
+		// the final save of the tracker must not be overwritten by a save of the subscriber which is still running
+		<-persisted
+	})
+}
+
+// serve runs the server until SIGINT or SIGTERM. The background work is stopped and waited for first with
+// stopBackground, so running jobs are queued again after the restart instead of failing. Requests in flight get
+// COMPANION_DRAIN_TIMEOUT (default 30s) to finish, afterwards the tracked containers are stopped if
+// COMPANION_STOP_ON_EXIT is true or the model servers run as processes, and the tracker is saved together with the
+// prediction cache if COMPANION_CACHE_PERSIST is true.
+func serve(handler http.Handler, stopBackground func()) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	httpServer := &http.Server{Addr: ":" + port, Handler: handler}
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	// the job workers, the reaper and the garbage collector must not work against the shutdown
+	stopBackground()
+	log.Println("shutting down, waiting for requests in flight")
+
+	drainTimeout := 30 * time.Second
+	if timeout, err := time.ParseDuration(os.Getenv("COMPANION_DRAIN_TIMEOUT")); err == nil {
+		drainTimeout = timeout
+	}
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(drainCtx); err != nil {
+		log.Println("requests were cut off:", err)
+	}
+
+	// child processes would be left behind without anyone supervising them
+	if os.Getenv("COMPANION_STOP_ON_EXIT") == "true" || os.Getenv("COMPANION_RUNTIME") == "process" {
+		stopCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		if err := lifecycle.StopAll(stopCtx); err != nil {
+			log.Println("could not stop all containers:", err)
+		}
+	}
+
+	lifecycle.PersistContainers()
+	if os.Getenv("COMPANION_CACHE_PERSIST") == "true" {
+		lifecycle.PersistPredictionCache()
+	}
+	log.Println("server stopped")
 }
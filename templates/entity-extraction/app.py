@@ -1,13 +1,18 @@
 import spacy
 import flask
 from flask import Flask, request, Response
-from train import train_model, check_trainingsData
+from train import train_model, check_trainingsData, model_path
 
 NLP = None
 
 app = Flask(__name__)
 
 
+@app.route('/health', methods=['GET'])
+def health():
+    return 'ok', 200
+
+
 @app.route('/predict', methods=['POST'])
 def predict():
     content = request.json
@@ -24,7 +29,7 @@ def predict():
 @app.route('/load/<version>', methods=['GET'])
 def load(version):
     global NLP
-    output_dir = f"/mnt/model-{version}"
+    output_dir = model_path(f"/mnt/model-{version}")
     try:
         NLP = spacy.load(output_dir)
         return flask.Response(status=201)
@@ -4,8 +4,19 @@ from pathlib import Path
 import spacy
 from tqdm import tqdm
 import json
+import os
 import yaml
 
+# the model folder, mounted to /mnt inside the container
+MODEL_DIR = os.environ.get('MODEL_DIR', '/mnt')
+
+
+def model_path(path):
+    # paths in the config refer to the model folder as /mnt
+    if path.startswith('/mnt/'):
+        return os.path.join(MODEL_DIR, path[len('/mnt/'):])
+    return path
+
 
 def load_config(path):
     return yaml.safe_load(open(path))
@@ -23,12 +34,12 @@ def load_data(path):
 
 
 def check_trainingsData():
-    config = load_config("/mnt/data/config.yml")
-    return load_data(config["trainingsData"])
+    config = load_config(model_path("/mnt/data/config.yml"))
+    return load_data(model_path(config["trainingsData"]))
 
 
 def train_model(train_data):
-    config = load_config("/mnt/data/config.yml")
+    config = load_config(model_path("/mnt/data/config.yml"))
 
     n_iter = config["n_iter"]
 
@@ -59,4 +70,4 @@ def train_model(train_data):
             yield "data: " + "iterations: " + str(itn+1) + "/" + str(n_iter) + " " + str(losses) + "\n"
 
     nlp.meta['name'] = 'companionAI-ner'
-    nlp.to_disk(f"/mnt/model-{config['currentVersion']}")
\ No newline at end of file
+    nlp.to_disk(model_path(f"/mnt/model-{config['currentVersion']}"))
\ No newline at end of file
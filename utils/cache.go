@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"companionAI/helper"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SavePredictionCache writes the cached predictions to the state folder.
+func SavePredictionCache(dir string, predictions []helper.CachedPrediction) error {
+	if err := os.MkdirAll(containerStateDir(dir), 0755); err != nil {
+		return err
+	}
+	return Save(containerStateDir(dir)+"/predictionCache.json", predictions)
+}
+
+// LoadPredictionCache reads the predictions saved by SavePredictionCache. A missing file results in no predictions.
+func LoadPredictionCache(dir string) ([]helper.CachedPrediction, error) {
+	var predictions []helper.CachedPrediction
+	err := Load(containerStateDir(dir)+"/predictionCache.json", &predictions)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return predictions, err
+}
+
+// TrainedAt returns when the version of the model was trained last, which is the latest change inside the folder the
+// model server saves the trained model to. Versions which were never trained return the zero time.
+func TrainedAt(dir string, modelId string, version string) (time.Time, error) {
+	var trainedAt time.Time
+	err := filepath.WalkDir(dir+"/mnt/models/"+modelId+"/model-"+version, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(trainedAt) {
+			trainedAt = info.ModTime()
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	return trainedAt, err
+}
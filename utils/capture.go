@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"bufio"
+	"companionAI/helper"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Defaults for the rotation of the capture files.
+const (
+	DefaultCaptureFileSize = 10 * 1024 * 1024
+	DefaultCaptureFiles    = 5
+)
+
+// captureLock serializes the appends and rotations of the capture files of all models.
+var captureLock sync.Mutex
+
+func captureDir(dir string, modelId string) string {
+	return dir + "/mnt/models/" + modelId + "/captures"
+}
+
+// capturePath returns the path of the capture file, 0 is the current file and higher numbers are older ones.
+func capturePath(dir string, modelId string, number int) string {
+	if number == 0 {
+		return captureDir(dir, modelId) + "/predictions.jsonl"
+	}
+	return fmt.Sprintf("%s/predictions.%d.jsonl", captureDir(dir, modelId), number)
+}
+
+func SetCapture(dir string, modelId string, capture helper.CaptureConfig) error {
+	if capture.MaxFileSize < 0 || capture.MaxFiles < 0 {
+		return errors.New("max-file-size and max-files can not be negative")
+	}
+
+	config, err := LoadConfig(dir, modelId)
+	if err != nil {
+		return err
+	}
+
+	config.Capture = &capture
+	configPath := dir + "/mnt/models/" + modelId + "/config.json"
+
+	return Save(configPath, config)
+}
+
+// AppendCapture appends the prediction as one json line to the capture file of the model. The file is rotated first
+// if the line would make it larger than the configured size.
+func AppendCapture(dir string, modelId string, capture helper.CaptureConfig, prediction helper.CapturedPrediction) error {
+	line, err := json.Marshal(prediction)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	maxSize, maxFiles := capture.MaxFileSize, capture.MaxFiles
+	if maxSize == 0 {
+		maxSize = DefaultCaptureFileSize
+	}
+	if maxFiles == 0 {
+		maxFiles = DefaultCaptureFiles
+	}
+
+	captureLock.Lock()
+	defer captureLock.Unlock()
+
+	if err := os.MkdirAll(captureDir(dir, modelId), 0755); err != nil {
+		return err
+	}
+	if info, err := os.Stat(capturePath(dir, modelId, 0)); err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > maxSize {
+		if err := rotateCaptures(dir, modelId, maxFiles); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(capturePath(dir, modelId, 0), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(line)
+	return err
+}
+
+// rotateCaptures has to be called with the captureLock held. The oldest file is dropped.
+func rotateCaptures(dir string, modelId string, maxFiles int) error {
+	if err := os.Remove(capturePath(dir, modelId, maxFiles-1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for number := maxFiles - 2; number >= 0; number-- {
+		err := os.Rename(capturePath(dir, modelId, number), capturePath(dir, modelId, number+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadCaptures reads the captured predictions of the model from all capture files, the oldest first. Lines which can
+// not be parsed, e.g. one cut off by a crash, are skipped.
+func LoadCaptures(dir string, modelId string) ([]helper.CapturedPrediction, error) {
+	captureLock.Lock()
+	defer captureLock.Unlock()
+
+	var oldest int
+	for oldest = 0; ; oldest++ {
+		if _, err := os.Stat(capturePath(dir, modelId, oldest+1)); err != nil {
+			break
+		}
+	}
+
+	predictions := []helper.CapturedPrediction{}
+	for number := oldest; number >= 0; number-- {
+		f, err := os.Open(capturePath(dir, modelId, number))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			var prediction helper.CapturedPrediction
+			if err := json.Unmarshal(scanner.Bytes(), &prediction); err == nil {
+				predictions = append(predictions, prediction)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return predictions, nil
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"companionAI/helper"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func capturedPrediction(number int) helper.CapturedPrediction {
+	return helper.CapturedPrediction{
+		Id:      fmt.Sprintf("p%d", number),
+		ModelId: "m1",
+		Version: "v1",
+		Status:  200,
+		Request: json.RawMessage(`{"sentence":"a"}`),
+	}
+}
+
+func TestAppendCaptureRotation(t *testing.T) {
+	line, err := json.Marshal(capturedPrediction(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every prediction of the test has the same size
+	lineSize := int64(len(line) + 1)
+
+	tests := []struct {
+		name        string
+		maxFileSize int64
+		maxFiles    int
+		appends     int
+		wantFiles   int
+		// want are the ids of the kept predictions, the oldest first
+		want []string
+	}{
+		{name: "single file", maxFileSize: 2 * lineSize, maxFiles: 3, appends: 2, wantFiles: 1, want: []string{"p0", "p1"}},
+		{name: "rotated once", maxFileSize: 2 * lineSize, maxFiles: 3, appends: 3, wantFiles: 2, want: []string{"p0", "p1", "p2"}},
+		{name: "all files used", maxFileSize: 2 * lineSize, maxFiles: 3, appends: 6, wantFiles: 3, want: []string{"p0", "p1", "p2", "p3", "p4", "p5"}},
+		{name: "oldest file dropped", maxFileSize: 2 * lineSize, maxFiles: 3, appends: 8, wantFiles: 3, want: []string{"p2", "p3", "p4", "p5", "p6", "p7"}},
+		{name: "line larger than file size", maxFileSize: 1, maxFiles: 2, appends: 3, wantFiles: 2, want: []string{"p1", "p2"}},
+		{name: "single file kept", maxFileSize: 2 * lineSize, maxFiles: 1, appends: 3, wantFiles: 1, want: []string{"p2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			capture := helper.CaptureConfig{Enabled: true, MaxFileSize: test.maxFileSize, MaxFiles: test.maxFiles}
+			for i := 0; i < test.appends; i++ {
+				if err := AppendCapture(dir, "m1", capture, capturedPrediction(i)); err != nil {
+					t.Fatalf("AppendCapture() error = %v", err)
+				}
+			}
+
+			entries, err := os.ReadDir(captureDir(dir, "m1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != test.wantFiles {
+				t.Errorf("got %d capture files, want %d", len(entries), test.wantFiles)
+			}
+
+			predictions, err := LoadCaptures(dir, "m1")
+			if err != nil {
+				t.Fatalf("LoadCaptures() error = %v", err)
+			}
+			var got []string
+			for _, prediction := range predictions {
+				got = append(got, prediction.Id)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("LoadCaptures() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadCapturesSkipsBrokenLines(t *testing.T) {
+	dir := t.TempDir()
+	if err := AppendCapture(dir, "m1", helper.CaptureConfig{Enabled: true}, capturedPrediction(0)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(capturePath(dir, "m1", 0), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cut off by a crash
+	f.WriteString(`{"id":"p1","mod` + "\n")
+	f.Close()
+
+	predictions, err := LoadCaptures(dir, "m1")
+	if err != nil {
+		t.Fatalf("LoadCaptures() error = %v", err)
+	}
+	if len(predictions) != 1 || predictions[0].Id != "p0" {
+		t.Errorf("LoadCaptures() = %+v, want only p0", predictions)
+	}
+}
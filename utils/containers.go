@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"companionAI/dockerManager"
+	"errors"
+	"os"
+)
+
+func containerStateDir(dir string) string {
+	return dir + "/mnt/state"
+}
+
+// SaveContainerTracker writes the tracked containers to the state folder, so they survive a restart of the server.
+func SaveContainerTracker(dir string, containerTracker map[string]dockerManager.ContainerInformation) error {
+	if err := os.MkdirAll(containerStateDir(dir), 0755); err != nil {
+		return err
+	}
+	return Save(containerStateDir(dir)+"/containers.json", containerTracker)
+}
+
+// LoadContainerTracker reads the containers saved by SaveContainerTracker. A missing file results in an empty tracker.
+func LoadContainerTracker(dir string) (map[string]dockerManager.ContainerInformation, error) {
+	containerTracker := make(map[string]dockerManager.ContainerInformation)
+	err := Load(containerStateDir(dir)+"/containers.json", &containerTracker)
+	if errors.Is(err, os.ErrNotExist) {
+		return containerTracker, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return containerTracker, nil
+}
@@ -4,15 +4,26 @@ import (
 	"bytes"
 	"companionAI/helper"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"sync"
+	"time"
 )
 
 type Config struct {
 	Modeltype     string   `json:"model-type"`
 	NewestVersion string   `json:"newest-version"`
 	Labels        []string `json:"labels"`
+	IdleTimeout   string   `json:"idle-timeout,omitempty"`
+	// Replicas is the number of containers per version, versions which are missing run a single container.
+	Replicas      map[string]int        `json:"replicas,omitempty"`
+	LoadBalancing string                `json:"load-balancing,omitempty"`
+	Resources     *helper.Resources     `json:"resources,omitempty"`
+	RestartPolicy *helper.RestartPolicy `json:"restart-policy,omitempty"`
+	Capture       *helper.CaptureConfig `json:"capture,omitempty"`
+	Routing       *helper.RoutingConfig `json:"routing,omitempty"`
 }
 
 var Marshal = func(v interface{}) (io.Reader, error) {
@@ -68,6 +79,90 @@ func LoadConfig(dir string, modelId string) (Config, error) {
 	return config, nil
 }
 
+// IdleTimeout returns how long a container of the model may stay without requests. Zero means it is never stopped.
+func IdleTimeout(dir string, modelId string) (time.Duration, error) {
+	config, err := LoadConfig(dir, modelId)
+	if err != nil {
+		return 0, err
+	}
+
+	if config.IdleTimeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(config.IdleTimeout)
+}
+
+// Replicas returns how many containers should serve the version of the model.
+func Replicas(dir string, modelId string, version string) (int, error) {
+	config, err := LoadConfig(dir, modelId)
+	if err != nil {
+		return 0, err
+	}
+
+	replicas, ok := config.Replicas[version]
+	if !ok {
+		return 1, nil
+	}
+	return replicas, nil
+}
+
+func SetReplicas(dir string, modelId string, version string, replicas int) error {
+	config, err := LoadConfig(dir, modelId)
+	if err != nil {
+		return err
+	}
+
+	if config.Replicas == nil {
+		config.Replicas = make(map[string]int)
+	}
+	config.Replicas[version] = replicas
+	configPath := dir + "/mnt/models/" + modelId + "/config.json"
+
+	return Save(configPath, config)
+}
+
+func SetRouting(dir string, modelId string, routing helper.RoutingConfig) error {
+	total := 0
+	for version, weight := range routing.Weights {
+		if weight < 0 {
+			return fmt.Errorf("weight of version %s can not be negative", version)
+		}
+		total += weight
+	}
+	if len(routing.Weights) > 0 && total == 0 {
+		return errors.New("at least one version needs a weight")
+	}
+	if routing.Shadow != nil && (routing.Shadow.Version == "" || routing.Shadow.Percent < 0 || routing.Shadow.Percent > 100) {
+		return errors.New("the shadow needs a version and a percent between 0 and 100")
+	}
+
+	config, err := LoadConfig(dir, modelId)
+	if err != nil {
+		return err
+	}
+
+	config.Routing = &routing
+	configPath := dir + "/mnt/models/" + modelId + "/config.json"
+
+	return Save(configPath, config)
+}
+
+func SetResources(dir string, modelId string, resources helper.Resources) error {
+	if _, err := ResourceLimits(resources); err != nil {
+		return err
+	}
+
+	config, err := LoadConfig(dir, modelId)
+	if err != nil {
+		return err
+	}
+
+	config.Resources = &resources
+	configPath := dir + "/mnt/models/" + modelId + "/config.json"
+
+	return Save(configPath, config)
+}
+
 func AddLabels(dir string, modelId string, labels []string) ([]string, error) {
 
 	config, err := LoadConfig(dir, modelId)
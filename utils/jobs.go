@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+func jobStateDir(dir string) string {
+	return containerStateDir(dir) + "/jobs"
+}
+
+// SaveJob writes a prediction job to the state folder, one file per job.
+func SaveJob(dir string, id string, job interface{}) error {
+	if err := os.MkdirAll(jobStateDir(dir), 0755); err != nil {
+		return err
+	}
+	return Save(jobStateDir(dir)+"/"+id+".json", job)
+}
+
+// LoadJobs reads every saved job with load, which gets the path of the job file.
+func LoadJobs(dir string, load func(path string) error) error {
+	paths, err := filepath.Glob(jobStateDir(dir) + "/*.json")
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := load(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RemoveJob(dir string, id string) error {
+	err := os.Remove(jobStateDir(dir) + "/" + id + ".json")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
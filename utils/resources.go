@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"companionAI/dockerManager"
+	"companionAI/helper"
+	"fmt"
+	"runtime"
+
+	"github.com/docker/go-units"
+)
+
+// minimumMemory is the smallest memory limit docker accepts for a container.
+const minimumMemory = 6 * 1024 * 1024
+
+// ResourceLimits validates the resources of a model config and converts them for the runtime. Unset values stay
+// unlimited.
+func ResourceLimits(resources helper.Resources) (dockerManager.ResourceLimits, error) {
+	var limits dockerManager.ResourceLimits
+
+	if resources.Cpus < 0 || resources.Cpus > float64(runtime.NumCPU()) {
+		return limits, fmt.Errorf("cpus must be between 0 and %d", runtime.NumCPU())
+	}
+	limits.NanoCpus = int64(resources.Cpus * 1e9)
+
+	if resources.Memory != "" {
+		memory, err := units.RAMInBytes(resources.Memory)
+		if err != nil {
+			return limits, fmt.Errorf("invalid memory limit: %w", err)
+		}
+		if memory < minimumMemory {
+			return limits, fmt.Errorf("memory limit must be at least 6m")
+		}
+		limits.Memory = memory
+	}
+
+	if resources.PidsLimit < 0 {
+		return limits, fmt.Errorf("pids-limit can not be negative")
+	}
+	limits.PidsLimit = resources.PidsLimit
+
+	return limits, nil
+}
+
+// LoadResourceLimits returns the validated resource limits of a model, models without resources are unlimited.
+func LoadResourceLimits(dir string, modelId string) (dockerManager.ResourceLimits, error) {
+	config, err := LoadConfig(dir, modelId)
+	if err != nil {
+		return dockerManager.ResourceLimits{}, err
+	}
+	if config.Resources == nil {
+		return dockerManager.ResourceLimits{}, nil
+	}
+	return ResourceLimits(*config.Resources)
+}